@@ -13,7 +13,13 @@ func main() {
 	var env = flag.String("env", "local", "If this is true, it will read the database_test settings.")
 	var settingTomlPath = flag.String("setting_toml_path", "", "Path to the db settings toml file")
 	var export = flag.Bool("export", false, "Output schema toml strings")
-	flag.Parse()
+	// gomig partitions -toml_path=...でパーティションのメンテナンスのみ行う
+	partitions := len(os.Args) > 1 && os.Args[1] == "partitions"
+	if partitions {
+		_ = flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
 
 	if *tomlPath == "" {
 		fmt.Println("ERROR: toml_path is required")
@@ -29,6 +35,15 @@ func main() {
 		os.Exit(0)
 	}
 
+	if partitions {
+		err := proc.ExecPartitions(*tomlPath, *env, *settingTomlPath, false, *sqlOnly)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	err := proc.Exec(*tomlPath, *env, *settingTomlPath, false, *sqlOnly)
 	if err != nil {
 		fmt.Println(err)
@@ -0,0 +1,267 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+func isEnumType(columnType string) bool {
+	return columnType == "enum" || columnType == "set"
+}
+
+// e.g. 'a','b' -> ["a", "b"]
+// DBのCOLUMN_TYPEは値の中のクォートを2つ重ねて、バックスラッシュはバックスラッシュでエスケープしている
+func parseEnumValues(valuesString string) (result []string, err error) {
+	var value strings.Builder
+	inQuote := false
+	for i := 0; i < len(valuesString); i++ {
+		c := valuesString[i]
+		if !inQuote {
+			switch c {
+			case '\'':
+				inQuote = true
+				value.Reset()
+			case ',', ' ':
+			default:
+				err = errors.New(fmt.Sprintf("enum values: %v is unknown format", valuesString))
+				return
+			}
+			continue
+		}
+		switch {
+		case c == '\'' && i+1 < len(valuesString) && valuesString[i+1] == '\'':
+			value.WriteByte('\'')
+			i++
+		case c == '\'':
+			inQuote = false
+			result = append(result, value.String())
+		case c == '\\' && i+1 < len(valuesString):
+			i++
+			switch valuesString[i] {
+			case 'n':
+				value.WriteByte('\n')
+			case 'r':
+				value.WriteByte('\r')
+			case 't':
+				value.WriteByte('\t')
+			case '0':
+				value.WriteByte(0)
+			case 'Z':
+				value.WriteByte('\032')
+			default:
+				value.WriteByte(valuesString[i])
+			}
+		default:
+			value.WriteByte(c)
+		}
+	}
+	if inQuote {
+		err = errors.New(fmt.Sprintf("enum values: %v is not closed", valuesString))
+		return
+	}
+
+	return
+}
+
+func buildEnumValues(values []string) string {
+	quoted := []string{}
+	for _, value := range values {
+		value = strings.ReplaceAll(value, `\`, `\\`)
+		value = strings.ReplaceAll(value, `'`, `''`)
+		quoted = append(quoted, fmt.Sprintf(`'%v'`, value))
+	}
+
+	return strings.Join(quoted, ",")
+}
+
+// 既存の値の後ろに値を追加するだけか
+// 値の数で保存に使うバイト数が変わる場合はテーブル再構築になるので除く
+func isEnumAppend(from, to tableColumn) bool {
+	if !isEnumType(from.columnType) || from.columnType != to.columnType || len(to.values) <= len(from.values) {
+		return false
+	}
+	for i, value := range from.values {
+		if to.values[i] != value {
+			return false
+		}
+	}
+	if enumStorageBytes(from) != enumStorageBytes(to) {
+		return false
+	}
+	from.values = to.values
+
+	return reflect.DeepEqual(from, to)
+}
+
+// enumは255個まで1バイト、setは8個ごとに1バイト(33個以上は8バイト)
+func enumStorageBytes(tc tableColumn) int {
+	if tc.columnType == "enum" {
+		if len(tc.values) <= 255 {
+			return 1
+		}
+		return 2
+	}
+	bytes := (len(tc.values) + 7) / 8
+	if bytes > 4 {
+		return 8
+	}
+
+	return bytes
+}
+
+func isPrecisionType(columnType string) bool {
+	return columnType == "decimal" || columnType == "float" || columnType == "double"
+}
+
+func isTemporalType(columnType string) bool {
+	return columnType == "datetime" || columnType == "timestamp" || columnType == "time"
+}
+
+// normalizePrecision sizeに書かれた(10,2)や(6)をprecision, scale, fspにして、省略した値はDBと同じデフォルトにする
+// decimalは(10,0)、fspの0は省略、scaleのないfloat(p)はpでfloatかdoubleになるだけで桁数は残らない
+func normalizePrecision(tc tableColumn) tableColumn {
+	if isPrecisionType(tc.columnType) && tc.size != "" {
+		sizes := strings.SplitN(tc.size, ",", 2)
+		tc.precision = strings.TrimSpace(sizes[0])
+		if len(sizes) > 1 {
+			tc.scale = strings.TrimSpace(sizes[1])
+		}
+		tc.size = ""
+	}
+	if isTemporalType(tc.columnType) && tc.size != "" {
+		tc.fsp = tc.size
+		tc.size = ""
+	}
+
+	switch tc.columnType {
+	case "decimal":
+		if tc.precision == "" {
+			tc.precision = "10"
+		}
+		if tc.scale == "" {
+			tc.scale = "0"
+		}
+	case "float", "double":
+		if tc.scale == "" {
+			if precision, err := strconv.Atoi(tc.precision); err == nil && precision > 24 {
+				tc.columnType = "double"
+			}
+			tc.precision = ""
+		}
+	case "datetime", "timestamp", "time":
+		if tc.fsp == "0" {
+			tc.fsp = ""
+		}
+	}
+
+	return tc
+}
+
+type columnTypeAlias struct {
+	columnType string
+	size       string // boolのtinyint(1)のように別名で決まるsize
+}
+
+// DBが返す型名と違う書き方
+var columnTypeAliases = map[string]columnTypeAlias{
+	"integer":           {columnType: "int"},
+	"int1":              {columnType: "tinyint"},
+	"int2":              {columnType: "smallint"},
+	"int3":              {columnType: "mediumint"},
+	"middleint":         {columnType: "mediumint"},
+	"int4":              {columnType: "int"},
+	"int8":              {columnType: "bigint"},
+	"bool":              {columnType: "tinyint", size: "1"},
+	"boolean":           {columnType: "tinyint", size: "1"},
+	"dec":               {columnType: "decimal"},
+	"numeric":           {columnType: "decimal"},
+	"fixed":             {columnType: "decimal"},
+	"real":              {columnType: "double"},
+	"double precision":  {columnType: "double"},
+	"float4":            {columnType: "float"},
+	"float8":            {columnType: "double"},
+	"character":         {columnType: "char"},
+	"character varying": {columnType: "varchar"},
+	"long":              {columnType: "mediumtext"},
+	"long varchar":      {columnType: "mediumtext"},
+}
+
+// DBの種類ごとの別名
+var flavorColumnTypeAliases = map[string]map[string]columnTypeAlias{
+	"mysql": {},
+	// mariadbのjsonはlongtextの別名でINFORMATION_SCHEMAでもlongtextになる
+	"mariadb": {
+		"json": {columnType: "longtext"},
+	},
+}
+
+// 整数型のデフォルトの表示幅
+var defaultDisplayWidths = map[string][2]string{ // [signed, unsigned]
+	"tinyint":   {"4", "3"},
+	"smallint":  {"6", "5"},
+	"mediumint": {"9", "8"},
+	"int":       {"11", "10"},
+	"bigint":    {"20", "20"},
+}
+
+func defaultDisplayWidth(columnType string, unsigned bool) string {
+	widths, exist := defaultDisplayWidths[columnType]
+	if !exist {
+		return ""
+	}
+	if unsigned {
+		return widths[1]
+	}
+
+	return widths[0]
+}
+
+// mysql8.0.19以降は整数型の表示幅を返さない(tinyint(1)のみ返す)
+func dropsDisplayWidth(server serverInfo) bool {
+	return !server.isMariaDB() && server.atLeast(8, 0, 19)
+}
+
+func resolveColumnTypeAlias(tc tableColumn, server serverInfo) tableColumn {
+	alias, exist := columnTypeAliases[tc.columnType]
+	if !exist {
+		alias, exist = flavorColumnTypeAliases[server.flavor][tc.columnType]
+	}
+	if exist {
+		tc.columnType = alias.columnType
+		if tc.size == "" {
+			tc.size = alias.size
+		}
+	}
+
+	return tc
+}
+
+// canonicalizeColumn tomlとDBで書き方が違う型を同じ表記にする
+// serverが空(tomlの読み込み時)の場合は接続先によらない別名とデフォルトの値だけ
+// 整数型の表示幅は省略した場合と表示幅を返さないDBの場合はデフォルトの表示幅にする
+// デフォルト値もcanonicalizeDefaultでそろえる
+func canonicalizeColumn(tc tableColumn, server serverInfo) tableColumn {
+	tc = resolveColumnTypeAlias(tc, server)
+	if width := defaultDisplayWidth(tc.columnType, tc.unsigned); width != "" {
+		if tc.size == "" || (dropsDisplayWidth(server) && !(tc.columnType == "tinyint" && tc.size == "1")) {
+			tc.size = width
+		}
+	}
+	switch tc.columnType {
+	case "year":
+		// year(4)以外は使えず、mysql8系は表示幅を返さない
+		tc.size = ""
+	case "bit", "binary":
+		if tc.size == "" {
+			tc.size = "1"
+		}
+	}
+
+	tc = normalizePrecision(tc)
+	tc.defaultValue = canonicalizeDefault(tc)
+
+	return tc
+}
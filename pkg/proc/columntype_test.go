@@ -0,0 +1,104 @@
+package proc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEnumValues(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{"'a','b'", []string{"a", "b"}, false},
+		{"'a', 'b c'", []string{"a", "b c"}, false},
+		{"'it''s','x,y'", []string{"it's", "x,y"}, false},
+		{"''", []string{""}, false},
+		{"a,b", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseEnumValues(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsEnumAppend(t *testing.T) {
+	tests := []struct {
+		name string
+		from []string
+		to   []string
+		want bool
+	}{
+		{"append", []string{"a", "b"}, []string{"a", "b", "c"}, true},
+		{"reorder", []string{"a", "b"}, []string{"b", "a", "c"}, false},
+		{"remove", []string{"a", "b"}, []string{"a"}, false},
+		{"same", []string{"a", "b"}, []string{"a", "b"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := tableColumn{name: "e", columnType: "enum", values: tt.from}
+			to := tableColumn{name: "e", columnType: "enum", values: tt.to}
+			if got := isEnumAppend(from, to); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizePrecision(t *testing.T) {
+	tests := []struct {
+		name string
+		tc   tableColumn
+		want tableColumn
+	}{
+		{"decimal default", tableColumn{columnType: "decimal"}, tableColumn{columnType: "decimal", precision: "10", scale: "0"}},
+		{"decimal size", tableColumn{columnType: "decimal", size: "8, 2"}, tableColumn{columnType: "decimal", precision: "8", scale: "2"}},
+		{"decimal precision only", tableColumn{columnType: "decimal", precision: "8"}, tableColumn{columnType: "decimal", precision: "8", scale: "0"}},
+		{"float precision", tableColumn{columnType: "float", precision: "10"}, tableColumn{columnType: "float"}},
+		{"float to double", tableColumn{columnType: "float", size: "30"}, tableColumn{columnType: "double"}},
+		{"float precision and scale", tableColumn{columnType: "float", precision: "7", scale: "3"}, tableColumn{columnType: "float", precision: "7", scale: "3"}},
+		{"datetime size", tableColumn{columnType: "datetime", size: "3"}, tableColumn{columnType: "datetime", fsp: "3"}},
+		{"timestamp fsp 0", tableColumn{columnType: "timestamp", fsp: "0"}, tableColumn{columnType: "timestamp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizePrecision(tt.tc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeColumn(t *testing.T) {
+	tests := []struct {
+		name   string
+		tc     tableColumn
+		server serverInfo
+		want   tableColumn
+	}{
+		{"int width", tableColumn{columnType: "int"}, serverInfo{}, tableColumn{columnType: "int", size: "11"}},
+		{"unsigned width", tableColumn{columnType: "int", unsigned: true}, serverInfo{}, tableColumn{columnType: "int", size: "10", unsigned: true}},
+		{"mysql8 drops width", tableColumn{columnType: "int", size: "5"}, testMySQL, tableColumn{columnType: "int", size: "11"}},
+		{"mysql8 keeps tinyint(1)", tableColumn{columnType: "tinyint", size: "1"}, testMySQL, tableColumn{columnType: "tinyint", size: "1"}},
+		{"mariadb json", tableColumn{columnType: "json"}, testMariaDB, tableColumn{columnType: "longtext"}},
+		{"mysql json", tableColumn{columnType: "json"}, testMySQL, tableColumn{columnType: "json"}},
+		{"year", tableColumn{columnType: "year", size: "4"}, testMySQL57, tableColumn{columnType: "year"}},
+		{"bool", tableColumn{columnType: "bool"}, testMySQL, tableColumn{columnType: "tinyint", size: "1"}},
+		{"bit default size", tableColumn{columnType: "bit"}, serverInfo{}, tableColumn{columnType: "bit", size: "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canonicalizeColumn(tt.tc, tt.server); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
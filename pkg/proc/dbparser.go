@@ -5,10 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var dbTypeReg = regexp.MustCompile(`(.+)\((.+)\)(.*)`)
+var createOptionReg = regexp.MustCompile(`(\w+)=(\S+)`)
+var mroongaCommentReg = regexp.MustCompile(`(\w+)\s+"([^"]*)"`)
+var fulltextParserReg = regexp.MustCompile("FULLTEXT KEY `([^`]+)` \\([^)]*\\)[^,\n]*WITH PARSER `?(\\w+)`?")
 
 func parseDB(dbName string) (result schema, err error) {
 	tableRows, err := dbConn.Query("SHOW TABLES")
@@ -39,6 +44,10 @@ func parseDB(dbName string) (result schema, err error) {
 		indexInfosSlice: map[string][]string{},
 		indexInfosMap:   map[string]map[string]*indexInfo{},
 	}
+	result.server, err = detectServer()
+	if err != nil {
+		return
+	}
 	indexInfosMap, indexMapSlice, err := parseDBIndex(dbName)
 	if err != nil {
 		return
@@ -60,34 +69,38 @@ func parseDB(dbName string) (result schema, err error) {
 	if err != nil {
 		return
 	}
-	useMroongaTableMap, err := parseDBMroongaTable(dbName)
+	enginesMap, engineOptionsMap, err := parseDBEngine(dbName)
+	if err != nil {
+		return
+	}
+	tableOptionsMap, err := parseDBTableOption(dbName)
+	if err != nil {
+		return
+	}
+	foreignKeysMap, err := parseDBForeignKey(dbName)
+	if err != nil {
+		return
+	}
+	descColumnsMap, err := parseDBColumns(dbName, result.server)
 	if err != nil {
 		return
 	}
 
-	var desc *sql.Rows
 	for _, table := range tables {
 		ti := tableInfo{name: table, columns: []tableColumn{}, columnsMap: map[string]tableColumn{}, partition: partitionInfo{}}
-		desc, err = dbConn.Query(fmt.Sprintf("DESC %v", table))
-		if err != nil {
-			return
-		}
-		if err = desc.Err(); err != nil {
-			return
-		}
-		for desc.Next() {
-			dc := &descColumns{}
-			err = desc.Scan(
-				&dc.field, &dc.columnType, &dc.null, &dc.key, &dc.defaultValue, &dc.extra,
-			)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
+		for _, dc := range descColumnsMap[table] {
 			tc := tableColumn{}
 			tc.name = dc.field
 			lowerType := strings.ToLower(dc.columnType)
-			if strings.Contains(lowerType, "(") {
+			if strings.HasPrefix(lowerType, "enum(") || strings.HasPrefix(lowerType, "set(") {
+				// 値にカンマや括弧が含まれることがあるので値はクォートを見て分ける 大文字小文字もそのまま
+				tc.columnType = lowerType[:strings.Index(lowerType, "(")]
+				tc.values, err = parseEnumValues(dc.columnType[len(tc.columnType)+1 : strings.LastIndex(dc.columnType, ")")])
+				if err != nil {
+					err = errors.New(fmt.Sprintf("table: %v column: %v %v", table, dc.field, err))
+					return
+				}
+			} else if strings.Contains(lowerType, "(") {
 				// 括弧が含まれていればサイズ指定があるカラムタイプ
 				res := dbTypeReg.FindAllStringSubmatch(lowerType, -1)
 				if len(res) <= 0 {
@@ -106,26 +119,19 @@ func parseDB(dbName string) (result schema, err error) {
 					tc.unsigned = true
 				}
 				tc.columnType = splitedType[0]
-				if tc.columnType == "int" {
-					if tc.unsigned {
-						tc.size = "10"
-					} else {
-						tc.size = "11"
-					}
-				} else if tc.columnType == "bigint" {
-					tc.size = "20"
-				}
 			}
+			tc.defaultValue = parseDBDefault(dc.defaultValue, dc.extra, result.server)
+			tc = canonicalizeColumn(tc, result.server)
 			if strings.ToLower(dc.null) == "yes" {
 				tc.null = true
 			}
-			if dc.defaultValue.Valid {
-				tc.defaultValue.need = true
-				tc.defaultValue.value = dc.defaultValue.String
-			}
 			if strings.Contains(dc.extra, "auto_increment") {
 				tc.autoInc = true
 			}
+			tc.onUpdate = parseDBOnUpdate(dc.extra)
+			tc.charset = dc.charset.String
+			tc.collation = dc.collation.String
+			tc.comment = dc.comment
 			ti.columns = append(ti.columns, tc)
 			ti.columnsMap[tc.name] = tc
 		}
@@ -134,8 +140,12 @@ func parseDB(dbName string) (result schema, err error) {
 			ti.partition = pInfo
 		}
 		// engine
-		if _, exist := useMroongaTableMap[table]; exist {
-			ti.engine = "Mroonga"
+		ti.engine = enginesMap[table]
+		ti.engineOption = engineOptionsMap[table]
+		ti.tableOption = tableOptionsMap[table]
+		// foreign key
+		if fks, exist := foreignKeysMap[table]; exist {
+			ti.foreignKeys = fks
 		}
 		result.tables = append(result.tables, ti)
 		result.tablesMap[table] = ti
@@ -144,11 +154,49 @@ func parseDB(dbName string) (result schema, err error) {
 		if _, exist := indexInfosMap[table]; exist {
 			result.indexInfosMap[table] = indexInfosMap[table]
 		}
+		if !isMroonga(ti.engine) && hasFullTextIndex(result.indexInfosMap[table]) {
+			// Mroonga以外はINDEX_COMMENTではなくWITH PARSERを見る
+			var parsers map[string]string
+			parsers, err = parseDBFullTextParser(table)
+			if err != nil {
+				return
+			}
+			for _, ii := range result.indexInfosMap[table] {
+				if ii.indexType == "FULLTEXT" {
+					ii.fulltext = fulltextOption{parser: parsers[ii.indexName]}
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// DESCではcharset, collation, commentが取れないのでINFORMATION_SCHEMA.COLUMNSから読む
+func parseDBColumns(dbName string, server serverInfo) (descColumnsMap map[string][]descColumns, err error) {
+	descColumnsMap = map[string][]descColumns{}
+
+	var rows *sql.Rows
+	rows, err = dbConn.Query(columnQuery(), dbName)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	if err = rows.Err(); err != nil {
+		return
 	}
-	if desc != nil {
-		if err = desc.Close(); err != nil {
-			return
+
+	for rows.Next() {
+		var tableName string
+		dc := descColumns{}
+		err = rows.Scan(
+			&tableName, &dc.field, &dc.columnType, &dc.null, &dc.key, &dc.defaultValue, &dc.extra, &dc.charset, &dc.collation, &dc.comment,
+		)
+		if err != nil {
+			fmt.Println(err)
+			continue
 		}
+		descColumnsMap[tableName] = append(descColumnsMap[tableName], dc)
 	}
 
 	return
@@ -173,8 +221,9 @@ func parseDBIndex(dbName string) (indexInfos map[string]map[string]*indexInfo, i
 		var nonUnique int
 		var seq int // not use
 		var columnName string
+		var comment string
 		err = rows.Scan(
-			&idxInfo.tableName, &nonUnique, &idxInfo.indexType, &idxInfo.indexName, &seq, &columnName,
+			&idxInfo.tableName, &nonUnique, &idxInfo.indexType, &idxInfo.indexName, &seq, &columnName, &comment,
 		)
 		if err != nil {
 			fmt.Println(err)
@@ -194,7 +243,7 @@ func parseDBIndex(dbName string) (indexInfos map[string]map[string]*indexInfo, i
 			indexInfos[idxInfo.tableName][idxInfo.indexName] = idxInfo
 		}
 		if idxInfo.indexType == "FULLTEXT" {
-			idxInfo.comment = `'tokenizer "TokenBigramSplitSymbolAlphaDigit"'`
+			idxInfo.fulltext = parseFullTextComment(comment)
 		}
 		indexInfos[idxInfo.tableName][idxInfo.indexName].columns = append(indexInfos[idxInfo.tableName][idxInfo.indexName].columns, columnName)
 	}
@@ -202,9 +251,82 @@ func parseDBIndex(dbName string) (indexInfos map[string]map[string]*indexInfo, i
 	return
 }
 
+// e.g. tokenizer "TokenBigram", normalizer "NormalizerAuto", token_filters "TokenFilterStopWord,TokenFilterStem"
+// 古いMroongaのparserはtokenizerとして扱う
+func parseFullTextComment(comment string) (result fulltextOption) {
+	for _, match := range mroongaCommentReg.FindAllStringSubmatch(comment, -1) {
+		switch strings.ToLower(match[1]) {
+		case "tokenizer", "parser":
+			result.tokenizer = match[2]
+		case "normalizer":
+			result.normalizer = match[2]
+		case "token_filters":
+			for _, tokenFilter := range strings.Split(match[2], ",") {
+				result.tokenFilters = append(result.tokenFilters, strings.TrimSpace(tokenFilter))
+			}
+		}
+	}
+
+	return
+}
+
+// e.g. engine "InnoDB", default_tokenizer "TokenMecab", normalizer "NormalizerAuto"
+func parseEngineComment(comment string) (result engineOption) {
+	for _, match := range mroongaCommentReg.FindAllStringSubmatch(comment, -1) {
+		switch strings.ToLower(match[1]) {
+		case "engine":
+			result.wrappedEngine = normalizeEngine(match[2])
+		case "default_tokenizer":
+			result.defaultTokenizer = match[2]
+		case "normalizer":
+			result.normalizer = match[2]
+		case "token_filters":
+			for _, tokenFilter := range strings.Split(match[2], ",") {
+				result.tokenFilters = append(result.tokenFilters, strings.TrimSpace(tokenFilter))
+			}
+		}
+	}
+
+	return
+}
+
+func hasFullTextIndex(indexInfos map[string]*indexInfo) bool {
+	for _, ii := range indexInfos {
+		if ii.indexType == "FULLTEXT" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WITH PARSERはINFORMATION_SCHEMAにないのでSHOW CREATE TABLEから読む
+// e.g. FULLTEXT KEY `ftk_example_body` (`body`) /*!50100 WITH PARSER `ngram` */
+func parseDBFullTextParser(tableName string) (parsers map[string]string, err error) {
+	parsers = map[string]string{}
+	var name, createTable string
+	err = dbConn.QueryRow(fmt.Sprintf("SHOW CREATE TABLE `%v`", tableName)).Scan(&name, &createTable)
+	if err != nil {
+		return
+	}
+	for _, match := range fulltextParserReg.FindAllStringSubmatch(createTable, -1) {
+		parsers[match[1]] = strings.ToLower(match[2])
+	}
+
+	return
+}
+
 func parseDBPartition(dbName string) (partitionInfosMap map[string]partitionInfo, err error) {
 	partitionInfosMap = map[string]partitionInfo{}
 
+	// UNIX_TIMESTAMPの区切りはDBのタイムゾーンで評価されているので日付に戻すときに使う
+	var offset int
+	err = dbConn.QueryRow(timeZoneOffsetQuery()).Scan(&offset)
+	if err != nil {
+		return
+	}
+	location := time.FixedZone("", offset)
+
 	var rows *sql.Rows
 	rows, err = dbConn.Query(partitionQuery(), dbName)
 	if err != nil {
@@ -215,31 +337,72 @@ func parseDBPartition(dbName string) (partitionInfosMap map[string]partitionInfo
 		return
 	}
 
+	definitionsMap := map[string][]partitionDefinition{}
+	tableNames := []string{}
 	for rows.Next() {
-		pInfo := partitionInfo{startNum: "1", eachRow: "10000"}
+		var pInfo partitionInfo
 		var tableName string
-		var partitionBaseName string
+		var pd partitionDefinition
+		var description, subPartitionType, subPartitionKey sql.NullString
 		err = rows.Scan(
-			&tableName, &partitionBaseName, &pInfo.endNum, &pInfo.partitionType, &pInfo.keyColumn,
+			&tableName, &pd.name, &pInfo.partitionType, &pInfo.keyColumn, &description, &subPartitionType, &subPartitionKey,
 		)
 		if err != nil {
 			fmt.Println(err)
 			continue
 		}
-		pInfo.partitionType = strings.ToLower(pInfo.partitionType)
-		splitPartitionName := strings.Split(partitionBaseName, pInfo.endNum)
-		pInfo.baseName = strings.Join(splitPartitionName[:len(splitPartitionName)-1], pInfo.endNum)
-		partitionInfosMap[tableName] = pInfo
+		if _, exist := partitionInfosMap[tableName]; !exist {
+			pInfo.partitionType = normalizePartitionType(pInfo.partitionType)
+			pInfo.keyColumn = normalizePartitionKey(pInfo.keyColumn)
+			if subPartitionType.Valid {
+				pInfo.subPartitionType = normalizePartitionType(subPartitionType.String)
+				pInfo.subPartitionKey = normalizePartitionKey(subPartitionKey.String)
+			}
+			partitionInfosMap[tableName] = pInfo
+			tableNames = append(tableNames, tableName)
+		}
+		if definitions := definitionsMap[tableName]; len(definitions) > 0 && definitions[len(definitions)-1].name == pd.name {
+			// サブパーティションの分だけ同じパーティションが続くので最初のパーティションで数える
+			if len(definitions) == 1 {
+				pInfo = partitionInfosMap[tableName]
+				subPartitions, _ := strconv.Atoi(pInfo.subPartitions)
+				pInfo.subPartitions = strconv.Itoa(subPartitions + 1)
+				partitionInfosMap[tableName] = pInfo
+			}
+			continue
+		}
+		if subPartitionType.Valid && len(definitionsMap[tableName]) == 0 {
+			pInfo = partitionInfosMap[tableName]
+			pInfo.subPartitions = "1"
+			partitionInfosMap[tableName] = pInfo
+		}
+		// hash, keyはNULL
+		if description.Valid {
+			pd.value = partitionValueFromDB(partitionInfosMap[tableName], description.String, location)
+		}
+		definitionsMap[tableName] = append(definitionsMap[tableName], pd)
 	}
+	for _, tableName := range tableNames {
+		partitionInfosMap[tableName] = partitionFromDefinitions(partitionInfosMap[tableName], definitionsMap[tableName])
+	}
+
+	return
+}
+
+// eachで区切ったパーティションの現在のパーティションを決めるためのパーティションキーの最大値
+func parseDBPartitionKeyMax(tableName, key string) (result sql.NullInt64, err error) {
+	err = dbConn.QueryRow(partitionKeyMaxQuery(tableName, key)).Scan(&result)
 
 	return
 }
 
-func parseDBMroongaTable(dbName string) (useMroongaTableMap map[string]struct{}, err error) {
-	useMroongaTableMap = map[string]struct{}{}
+// MroongaのテーブルはTABLE_COMMENTからengineOptionも読む
+func parseDBEngine(dbName string) (enginesMap map[string]string, engineOptionsMap map[string]engineOption, err error) {
+	enginesMap = map[string]string{}
+	engineOptionsMap = map[string]engineOption{}
 
 	var rows *sql.Rows
-	rows, err = dbConn.Query(mroongaEngineQuery(), dbName)
+	rows, err = dbConn.Query(engineQuery(), dbName)
 	if err != nil {
 		return
 	}
@@ -250,34 +413,160 @@ func parseDBMroongaTable(dbName string) (useMroongaTableMap map[string]struct{},
 
 	for rows.Next() {
 		var tableName string
-		var engine string
+		var engine sql.NullString
+		var comment sql.NullString
 		err = rows.Scan(
-			&tableName, &engine,
+			&tableName, &engine, &comment,
 		)
 		if err != nil {
 			fmt.Println(err)
 			continue
 		}
-		useMroongaTableMap[tableName] = struct{}{}
+		// VIEWはNULL
+		if engine.Valid {
+			enginesMap[tableName] = normalizeEngine(engine.String)
+		}
+		if isMroonga(enginesMap[tableName]) {
+			engineOptionsMap[tableName] = parseEngineComment(comment.String)
+		}
 	}
 
 	return
 }
 
+// ROW_FORMATはCREATE_OPTIONSに指定がある場合はそちら、KEY_BLOCK_SIZE, STATS_PERSISTENTはCREATE_OPTIONSにしかない
+// charsetはcollationの先頭(e.g. utf8mb4_general_ci -> utf8mb4)
+func parseDBTableOption(dbName string) (tableOptionsMap map[string]tableOption, err error) {
+	tableOptionsMap = map[string]tableOption{}
+
+	var rows *sql.Rows
+	rows, err = dbConn.Query(tableOptionQuery(), dbName)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	for rows.Next() {
+		var tableName string
+		var collation, comment, rowFormat, createOptions sql.NullString
+		var autoIncrement sql.NullInt64
+		err = rows.Scan(
+			&tableName, &collation, &comment, &rowFormat, &createOptions, &autoIncrement,
+		)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		option := tableOption{
+			collation:       strings.ToLower(collation.String),
+			comment:         comment.String,
+			rowFormat:       strings.ToUpper(rowFormat.String),
+			keyBlockSize:    "0",
+			statsPersistent: "DEFAULT",
+		}
+		option.charset = strings.Split(option.collation, "_")[0]
+		for _, match := range createOptionReg.FindAllStringSubmatch(createOptions.String, -1) {
+			switch strings.ToLower(match[1]) {
+			case "row_format":
+				option.rowFormat = strings.ToUpper(match[2])
+			case "key_block_size":
+				option.keyBlockSize = match[2]
+			case "stats_persistent":
+				option.statsPersistent = strings.ToUpper(match[2])
+			}
+		}
+		if autoIncrement.Valid {
+			option.autoIncrement = strconv.FormatInt(autoIncrement.Int64, 10)
+		}
+		tableOptionsMap[tableName] = option
+	}
+
+	return
+}
+
+func parseDBForeignKey(dbName string) (foreignKeysMap map[string][]foreignKeyInfo, err error) {
+	foreignKeysMap = map[string][]foreignKeyInfo{}
+
+	var rows *sql.Rows
+	rows, err = dbConn.Query(foreignKeyQuery(), dbName)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	for rows.Next() {
+		var tableName, constraintName, columnName, refTable, refColumn, updateRule, deleteRule string
+		err = rows.Scan(
+			&tableName, &constraintName, &columnName, &refTable, &refColumn, &updateRule, &deleteRule,
+		)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fks := foreignKeysMap[tableName]
+		// ORDINAL_POSITION順に並んでいるので同じ制約名が続く限り同じ外部キーのカラム
+		if len(fks) == 0 || fks[len(fks)-1].name != constraintName {
+			fks = append(fks, foreignKeyInfo{
+				tableName: tableName,
+				name:      constraintName,
+				refTable:  refTable,
+				onDelete:  normalizeReferentialAction(deleteRule),
+				onUpdate:  normalizeReferentialAction(updateRule),
+			})
+		}
+		fks[len(fks)-1].columns = append(fks[len(fks)-1].columns, columnName)
+		fks[len(fks)-1].refColumns = append(fks[len(fks)-1].refColumns, refColumn)
+		foreignKeysMap[tableName] = fks
+	}
+
+	return
+}
+
+func columnQuery() string {
+	return "SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE, COLUMN_KEY, COLUMN_DEFAULT, EXTRA, CHARACTER_SET_NAME, COLLATION_NAME, COLUMN_COMMENT FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME, ORDINAL_POSITION"
+}
+
 func indexQuery() string {
-	return "SELECT TABLE_NAME, NON_UNIQUE, INDEX_TYPE, INDEX_NAME, SEQ_IN_INDEX, COLUMN_NAME from INFORMATION_SCHEMA.STATISTICS WHERE TABLE_SCHEMA = ? ORDER BY INDEX_NAME, SEQ_IN_INDEX"
+	return "SELECT TABLE_NAME, NON_UNIQUE, INDEX_TYPE, INDEX_NAME, SEQ_IN_INDEX, COLUMN_NAME, INDEX_COMMENT from INFORMATION_SCHEMA.STATISTICS WHERE TABLE_SCHEMA = ? ORDER BY INDEX_NAME, SEQ_IN_INDEX"
 }
 
 func partitionQuery() string {
-	query := "SELECT ifp.TABLE_NAME, ifp.PARTITION_NAME, ifp.PARTITION_ORDINAL_POSITION, ifp.PARTITION_METHOD, ifp.PARTITION_EXPRESSION" +
-		" FROM INFORMATION_SCHEMA.PARTITIONS ifp" +
-		" LEFT JOIN INFORMATION_SCHEMA.PARTITIONS AS ifp2 ON ifp.TABLE_NAME = ifp2.TABLE_NAME AND ifp.PARTITION_ORDINAL_POSITION < ifp2.PARTITION_ORDINAL_POSITION" +
-		" WHERE ifp.TABLE_SCHEMA = ? AND ifp.PARTITION_NAME IS NOT NULL AND ifp2.PARTITION_ORDINAL_POSITION IS NULL" +
-		" ORDER BY ifp.TABLE_NAME"
+	query := "SELECT TABLE_NAME, PARTITION_NAME, PARTITION_METHOD, PARTITION_EXPRESSION, PARTITION_DESCRIPTION, SUBPARTITION_METHOD, SUBPARTITION_EXPRESSION" +
+		" FROM INFORMATION_SCHEMA.PARTITIONS" +
+		" WHERE TABLE_SCHEMA = ? AND PARTITION_NAME IS NOT NULL" +
+		" ORDER BY TABLE_NAME, PARTITION_ORDINAL_POSITION, SUBPARTITION_ORDINAL_POSITION"
 
 	return query
 }
 
-func mroongaEngineQuery() string {
-	return "SELECT table_name, engine FROM information_schema.tables WHERE table_schema = ? AND engine = 'Mroonga'"
+func partitionKeyMaxQuery(tableName, key string) string {
+	return fmt.Sprintf("SELECT MAX(%v) FROM %v", key, tableName)
+}
+
+func timeZoneOffsetQuery() string {
+	return "SELECT TIMESTAMPDIFF(SECOND, UTC_TIMESTAMP(), NOW())"
+}
+
+func engineQuery() string {
+	return "SELECT table_name, engine, table_comment FROM information_schema.tables WHERE table_schema = ?"
+}
+
+func tableOptionQuery() string {
+	return "SELECT table_name, table_collation, table_comment, row_format, create_options, auto_increment FROM information_schema.tables WHERE table_schema = ? AND table_type = 'BASE TABLE'"
+}
+
+func foreignKeyQuery() string {
+	query := "SELECT kcu.TABLE_NAME, kcu.CONSTRAINT_NAME, kcu.COLUMN_NAME, kcu.REFERENCED_TABLE_NAME, kcu.REFERENCED_COLUMN_NAME, rc.UPDATE_RULE, rc.DELETE_RULE" +
+		" FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE kcu" +
+		" INNER JOIN INFORMATION_SCHEMA.REFERENTIAL_CONSTRAINTS rc ON rc.CONSTRAINT_SCHEMA = kcu.CONSTRAINT_SCHEMA AND rc.TABLE_NAME = kcu.TABLE_NAME AND rc.CONSTRAINT_NAME = kcu.CONSTRAINT_NAME" +
+		" WHERE kcu.TABLE_SCHEMA = ? AND kcu.REFERENCED_TABLE_NAME IS NOT NULL" +
+		" ORDER BY kcu.TABLE_NAME, kcu.CONSTRAINT_NAME, kcu.ORDINAL_POSITION"
+
+	return query
 }
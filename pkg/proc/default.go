@@ -0,0 +1,322 @@
+package proc
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// デフォルト値の種類
+type defaultKind int
+
+const (
+	defaultLiteral    defaultKind = iota // 'abc', 5
+	defaultNull                          // DEFAULT NULL
+	defaultFunction                      // CURRENT_TIMESTAMP(fsp)
+	defaultExpression                    // (uuid())のような式
+)
+
+// CURRENT_TIMESTAMPと同じもの
+var currentTimestampReg = regexp.MustCompile(`(?i)^(current_timestamp|now|localtime|localtimestamp)\s*(?:\(\s*(\d*)\s*\))?$`)
+
+// COLUMNSのEXTRA e.g. DEFAULT_GENERATED on update CURRENT_TIMESTAMP(3)
+var onUpdateReg = regexp.MustCompile(`(?i)on update (current_timestamp|now|localtime|localtimestamp)\s*(?:\(\s*(\d*)\s*\))?`)
+
+// mysqlは式の中の文字列に_utf8mb4'a'のようにcharsetを付けて返す
+var introducerReg = regexp.MustCompile(`(?i)_(utf8mb4|utf8mb3|utf8|latin1|binary|ascii)'`)
+
+var numberReg = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// tomlのdefault
+// CURRENT_TIMESTAMPなどは関数、以前からの指定で()を含むものは式として扱う
+func parseTomlDefault(value string) (result defaultDetail) {
+	result = defaultDetail{need: true, value: value}
+	if match := currentTimestampReg.FindStringSubmatch(value); match != nil {
+		result.kind = defaultFunction
+		result.value = "CURRENT_TIMESTAMP"
+		result.precision = match[2]
+	} else if strings.Contains(value, "()") {
+		result.kind = defaultExpression
+	}
+
+	return
+}
+
+// tomlのdefault_expr クォートせずにそのまま書くもの
+// NULLはDEFAULT NULL、b'0'や数値はリテラル、それ以外は式として扱う
+func parseTomlDefaultExpr(value string) (result defaultDetail) {
+	value = strings.TrimSpace(value)
+	result = defaultDetail{need: true, value: value}
+	switch {
+	case currentTimestampReg.MatchString(value):
+		result = parseTomlDefault(value)
+	case strings.ToUpper(value) == "NULL":
+		result.kind = defaultNull
+		result.value = "NULL"
+	case numberReg.MatchString(value), isBitLiteral(value):
+	default:
+		result.kind = defaultExpression
+	}
+
+	return
+}
+
+// tomlのon_update CURRENT_TIMESTAMPとその別名のみ
+func parseTomlOnUpdate(value string) (result string, ok bool) {
+	match := currentTimestampReg.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return
+	}
+
+	return buildCurrentTimestamp(match[2]), true
+}
+
+// DBのEXTRAのon update
+func parseDBOnUpdate(extra string) (result string) {
+	match := onUpdateReg.FindStringSubmatch(extra)
+	if match == nil {
+		return
+	}
+
+	return buildCurrentTimestamp(match[2])
+}
+
+// 小数秒の桁数の0は省略した場合と同じ
+func buildCurrentTimestamp(precision string) string {
+	if precision == "" || precision == "0" {
+		return "CURRENT_TIMESTAMP"
+	}
+
+	return fmt.Sprintf("CURRENT_TIMESTAMP(%v)", precision)
+}
+
+// DBのCOLUMN_DEFAULTとEXTRA
+// mariadb10.2.7以降は文字列がクォートされていて、デフォルトなしのNULLも文字列のNULL、関数はcurrent_timestamp()になる
+// mysqlはクォートなしで、関数や式はEXTRAにDEFAULT_GENERATEDが付く(8.0.13以降)
+func parseDBDefault(value sql.NullString, extra string, server serverInfo) (result defaultDetail) {
+	if !value.Valid {
+		return
+	}
+	result = defaultDetail{need: true, value: value.String}
+	if match := currentTimestampReg.FindStringSubmatch(value.String); match != nil {
+		result.kind = defaultFunction
+		result.value = "CURRENT_TIMESTAMP"
+		result.precision = match[2]
+		return
+	}
+	if server.isMariaDB() && server.atLeast(10, 2, 7) {
+		switch {
+		case value.String == "NULL":
+			result = defaultDetail{}
+		case len(value.String) >= 2 && strings.HasPrefix(value.String, "'") && strings.HasSuffix(value.String, "'"):
+			result.value = unquoteDefault(value.String[1 : len(value.String)-1])
+		case numberReg.MatchString(value.String), isBitLiteral(value.String):
+		default:
+			result.kind = defaultExpression
+		}
+		return
+	}
+	if strings.Contains(strings.ToUpper(extra), "DEFAULT_GENERATED") {
+		// 式の中のクォートは\'になっている e.g. concat(_utf8mb4\'a\',x)
+		result.kind = defaultExpression
+		result.value = strings.ReplaceAll(value.String, `\'`, `'`)
+	}
+
+	return
+}
+
+func unquoteDefault(value string) string {
+	value = strings.ReplaceAll(value, "''", "'")
+	value = strings.ReplaceAll(value, `\\`, `\`)
+
+	return value
+}
+
+// e.g. b'0', x'1F'
+func isBitLiteral(value string) bool {
+	lower := strings.ToLower(value)
+
+	return (strings.HasPrefix(lower, "b'") || strings.HasPrefix(lower, "x'")) && strings.HasSuffix(lower, "'")
+}
+
+// canonicalizeDefault tomlとDBで書き方が違うデフォルト値を同じ表記にする
+// NULLを許すカラムのDEFAULT NULLはデフォルトなしと同じ
+// 数値は末尾の0など、日時は日付だけの書き方などをそろえる
+// 式はexportでそのまま書き出すので変えずに、比較するときだけcomparableDefaultでそろえる
+func canonicalizeDefault(tc tableColumn) defaultDetail {
+	dd := tc.defaultValue
+	if !dd.need {
+		return dd
+	}
+	switch dd.kind {
+	case defaultNull:
+		return defaultDetail{}
+	case defaultFunction:
+		if dd.precision == "0" {
+			dd.precision = ""
+		}
+	case defaultLiteral:
+		switch {
+		case tc.columnType == "bit":
+			dd.value = canonicalizeBit(dd.value)
+		case defaultDisplayWidth(tc.columnType, false) != "" || isPrecisionType(tc.columnType):
+			dd.value = canonicalizeNumber(dd.value)
+		case tc.columnType == "datetime" || tc.columnType == "timestamp":
+			dd.value = canonicalizeDatetime(dd.value, "2006-01-02 15:04:05.999999")
+		case tc.columnType == "date":
+			dd.value = canonicalizeDatetime(dd.value, "2006-01-02")
+		}
+	}
+
+	return dd
+}
+
+// e.g. +05.10 -> 5.1, 1e3 -> 1000
+func canonicalizeNumber(value string) string {
+	if !numberReg.MatchString(value) {
+		return value
+	}
+	if strings.ContainsAny(value, "eE") {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return value
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	sign := ""
+	if strings.HasPrefix(value, "-") {
+		sign = "-"
+	}
+	value = strings.TrimLeft(value, "+-")
+	if strings.Contains(value, ".") {
+		value = strings.TrimRight(strings.TrimRight(value, "0"), ".")
+	}
+	value = strings.TrimLeft(value, "0")
+	if value == "" || strings.HasPrefix(value, ".") {
+		value = "0" + value
+	}
+	if value == "0" {
+		sign = ""
+	}
+
+	return sign + value
+}
+
+// bitはDBがb'1010'の形で返すのでそろえる e.g. 10, x'0A', b'01010' -> b'1010'
+func canonicalizeBit(value string) string {
+	lower := strings.ToLower(value)
+	var parsed uint64
+	var err error
+	switch {
+	case strings.HasPrefix(lower, "b'") && strings.HasSuffix(lower, "'"):
+		parsed, err = strconv.ParseUint("0"+lower[2:len(lower)-1], 2, 64)
+	case strings.HasPrefix(lower, "x'") && strings.HasSuffix(lower, "'"):
+		parsed, err = strconv.ParseUint("0"+lower[2:len(lower)-1], 16, 64)
+	default:
+		parsed, err = strconv.ParseUint(value, 10, 64)
+	}
+	if err != nil {
+		return value
+	}
+
+	return fmt.Sprintf("b'%b'", parsed)
+}
+
+// e.g. 2020-01-01 -> 2020-01-01 00:00:00
+func canonicalizeDatetime(value, layout string) string {
+	if strings.HasPrefix(value, "0000-00-00") {
+		// ゼロの日付はtimeで扱えない
+		if len(layout) > len("2006-01-02") {
+			return "0000-00-00 00:00:00"
+		}
+		return "0000-00-00"
+	}
+	for _, from := range []string{"2006-01-02 15:04:05.999999", "2006-01-02T15:04:05.999999", "2006-01-02"} {
+		t, err := time.Parse(from, value)
+		if err == nil {
+			return t.Format(layout)
+		}
+	}
+
+	return value
+}
+
+// comparableDefault 比較用に式のデフォルト値の書き方をそろえる
+func comparableDefault(tc tableColumn) tableColumn {
+	if tc.defaultValue.kind == defaultExpression {
+		tc.defaultValue.value = canonicalizeExpression(tc.defaultValue.value)
+	}
+
+	return tc
+}
+
+// 外側の括弧、クォートの外の空白と大文字小文字の違い、文字列のcharsetの有無は同じとみなす
+func canonicalizeExpression(value string) string {
+	value = strings.TrimSpace(introducerReg.ReplaceAllString(value, "'"))
+	for strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") && isWrapped(value) {
+		value = strings.TrimSpace(value[1 : len(value)-1])
+	}
+	var result strings.Builder
+	var quote rune
+	for _, c := range value {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			result.WriteRune(c)
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+			result.WriteRune(c)
+		case c == ' ' || c == '\t' || c == '\n':
+		default:
+			result.WriteString(strings.ToLower(string(c)))
+		}
+	}
+
+	return result.String()
+}
+
+// 先頭の括弧が末尾の括弧と対応しているか e.g. (a)+(b)はfalse
+func isWrapped(value string) bool {
+	depth := 0
+	for i, c := range value {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 && i != len(value)-1 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// DEFAULT句 CREATE TABLE, ADD, MODIFY, CHANGE COLUMNで共通
+// 式はmysql8.0.13以降、mariadb10.2以降で括弧で囲む必要がある
+// bitのb'0'や数値はクォートすると文字列として扱われるのでそのまま書く
+func buildColumnDefault(tc tableColumn) string {
+	dd := tc.defaultValue
+	switch dd.kind {
+	case defaultNull:
+		return "DEFAULT NULL"
+	case defaultFunction:
+		return "DEFAULT " + buildCurrentTimestamp(dd.precision)
+	case defaultExpression:
+		if strings.HasPrefix(dd.value, "(") && isWrapped(dd.value) {
+			return fmt.Sprintf("DEFAULT %v", dd.value)
+		}
+		return fmt.Sprintf("DEFAULT (%v)", dd.value)
+	}
+	if tc.columnType == "bit" && (isBitLiteral(dd.value) || numberReg.MatchString(dd.value)) {
+		return fmt.Sprintf("DEFAULT %v", dd.value)
+	}
+
+	return fmt.Sprintf("DEFAULT '%v'", strings.ReplaceAll(strings.ReplaceAll(dd.value, `\`, `\\`), "'", "''"))
+}
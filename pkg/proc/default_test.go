@@ -0,0 +1,79 @@
+package proc
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestParseDBDefault(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  sql.NullString
+		extra  string
+		server serverInfo
+		want   defaultDetail
+	}{
+		{"no default", sql.NullString{}, "", testMySQL, defaultDetail{}},
+		{"mysql literal", sql.NullString{String: "it's", Valid: true}, "", testMySQL, defaultDetail{need: true, value: "it's"}},
+		{"mysql function", sql.NullString{String: "CURRENT_TIMESTAMP(3)", Valid: true}, "DEFAULT_GENERATED", testMySQL, defaultDetail{need: true, kind: defaultFunction, value: "CURRENT_TIMESTAMP", precision: "3"}},
+		{"mysql expression", sql.NullString{String: "uuid()", Valid: true}, "DEFAULT_GENERATED", testMySQL, defaultDetail{need: true, kind: defaultExpression, value: "uuid()"}},
+		{"mariadb quoted", sql.NullString{String: "'it''s'", Valid: true}, "", testMariaDB, defaultDetail{need: true, value: "it's"}},
+		{"mariadb null", sql.NullString{String: "NULL", Valid: true}, "", testMariaDB, defaultDetail{}},
+		{"mariadb number", sql.NullString{String: "5", Valid: true}, "", testMariaDB, defaultDetail{need: true, value: "5"}},
+		{"mariadb function", sql.NullString{String: "current_timestamp()", Valid: true}, "", testMariaDB, defaultDetail{need: true, kind: defaultFunction, value: "CURRENT_TIMESTAMP"}},
+		{"mariadb expression", sql.NullString{String: "uuid()", Valid: true}, "", testMariaDB, defaultDetail{need: true, kind: defaultExpression, value: "uuid()"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseDBDefault(tt.value, tt.extra, tt.server); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeDefault(t *testing.T) {
+	tests := []struct {
+		name string
+		tc   tableColumn
+		want defaultDetail
+	}{
+		{"null is no default", tableColumn{columnType: "int", null: true, defaultValue: defaultDetail{need: true, kind: defaultNull, value: "NULL"}}, defaultDetail{}},
+		{"function precision 0", tableColumn{columnType: "datetime", defaultValue: defaultDetail{need: true, kind: defaultFunction, value: "CURRENT_TIMESTAMP", precision: "0"}}, defaultDetail{need: true, kind: defaultFunction, value: "CURRENT_TIMESTAMP"}},
+		{"decimal", tableColumn{columnType: "decimal", defaultValue: defaultDetail{need: true, value: "+01.50"}}, defaultDetail{need: true, value: "1.5"}},
+		{"exponent", tableColumn{columnType: "double", defaultValue: defaultDetail{need: true, value: "1e3"}}, defaultDetail{need: true, value: "1000"}},
+		{"negative zero", tableColumn{columnType: "int", defaultValue: defaultDetail{need: true, value: "-0"}}, defaultDetail{need: true, value: "0"}},
+		{"datetime", tableColumn{columnType: "datetime", defaultValue: defaultDetail{need: true, value: "2020-01-01"}}, defaultDetail{need: true, value: "2020-01-01 00:00:00"}},
+		{"zero datetime", tableColumn{columnType: "datetime", defaultValue: defaultDetail{need: true, value: "0000-00-00 00:00:00"}}, defaultDetail{need: true, value: "0000-00-00 00:00:00"}},
+		{"date", tableColumn{columnType: "date", defaultValue: defaultDetail{need: true, value: "2020-01-01 00:00:00"}}, defaultDetail{need: true, value: "2020-01-01"}},
+		{"string", tableColumn{columnType: "varchar", defaultValue: defaultDetail{need: true, value: " 1.50 "}}, defaultDetail{need: true, value: " 1.50 "}},
+		{"expression is kept", tableColumn{columnType: "date", defaultValue: defaultDetail{need: true, kind: defaultExpression, value: "(cast(now() as date))"}}, defaultDetail{need: true, kind: defaultExpression, value: "(cast(now() as date))"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canonicalizeDefault(tt.tc); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeExpression(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"uuid()", "uuid()"},
+		{"(UUID())", "uuid()"},
+		{"( cast(now() as date) )", "cast(now()asdate)"},
+		{"(a) + (b)", "(a)+(b)"},
+		{"concat('A B', x)", "concat('A B',x)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := canonicalizeExpression(tt.value); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -7,62 +7,468 @@ import (
 	"strings"
 )
 
-// engineだけが違う場合ALTER発行しないので注意
 func procDiff(fromToml, fromDB schema) (result *Queries) {
 	result = &Queries{}
+	resolveFullTextOptions(fromToml, fromDB.server.defaultEngine)
+	fromDB = applyTableRenames(fromToml, fromDB, result)
+	fromDB = applyColumnRenames(fromToml, fromDB, result)
+	fromToml = keepGeneratedForeignKeyNames(fromToml, fromDB)
 	if !reflect.DeepEqual(fromToml.tablesMap, fromDB.tablesMap) {
 		procTableDiff(fromToml, fromDB, result)
+		procForeignKeyDiff(fromToml, fromDB, result)
+		procPartitionDiff(fromToml, fromDB, result)
+		procEngineDiff(fromToml, fromDB, result)
+		procTableOptionDiff(fromToml, fromDB, result)
 	}
 	if !reflect.DeepEqual(fromToml.indexInfosMap, fromDB.indexInfosMap) {
 		procIndexDiff(fromToml, fromDB, result)
 	}
+	bundleAutoIncKeys(result)
 
 	return
 }
 
 func procTableDiff(fromToml, fromDB schema, result *Queries) {
+	newTables := []tableInfo{}
 	for _, ti := range fromToml.tables {
 		// tomlにあってDBにないテーブルはcreate
 		if _, exist := fromDB.tablesMap[ti.name]; !exist {
-			result.CreateTables = append(result.CreateTables, buildCreateTableQuery(ti, fromToml.indexInfosMap[ti.name]))
+			newTables = append(newTables, ti)
 			continue
 		}
 		if !reflect.DeepEqual(ti.columns, fromDB.tablesMap[ti.name].columns) {
+			var moves map[string]string
+			if fromToml.options.syncColumnOrder {
+				moves = columnMoves(ti, fromDB.tablesMap[ti.name])
+			}
 			for idx, tc := range ti.columns {
-				if _, exist := fromDB.tablesMap[ti.name].columnsMap[tc.name]; !exist {
+				dbTc, exist := fromDB.tablesMap[ti.name].columnsMap[tc.name]
+				if !exist {
 					// tomlにあってDBにないカラムはadd
 					var beforeColumnName string
 					if idx != 0 {
 						beforeColumnName = ti.columns[idx-1].name
 					}
-					result.AddColumns = append(result.AddColumns, buildAddColumnTableQuery(ti, tc, beforeColumnName))
+					atEnd := true
+					for _, laterColumn := range ti.columns[idx+1:] {
+						if _, exist := fromDB.tablesMap[ti.name].columnsMap[laterColumn.name]; exist {
+							atEnd = false
+						}
+					}
+					result.add(newAddColumnChange(ti, tc, beforeColumnName, atEnd))
+					continue
+				}
+				// mariadbのjsonのように別名で文字列の型になるものも引き継ぐので先に型をDBと同じ表記にする
+				tc = inheritColumnCharset(resolveColumnTypeAlias(tc, fromDB.server), dbTc)
+				if beforeColumnName, move := moves[tc.name]; move {
+					// 並び順が違う場合は位置を指定してmodify
+					result.add(newMoveColumnChange(ti, tc, dbTc, beforeColumnName, fromDB.server))
 					continue
 				}
-				if !reflect.DeepEqual(tc, fromDB.tablesMap[ti.name].columnsMap[tc.name]) {
-					fmt.Println(tc)
-					fmt.Println(fromDB.tablesMap[ti.name].columnsMap[tc.name])
+				if !reflect.DeepEqual(comparableDefault(canonicalizeColumn(tc, fromDB.server)), comparableDefault(dbTc)) {
 					// 両方にあるがカラム内容に差分がある場合modify
-					result.ModifyColumns = append(result.ModifyColumns, buildModifyColumnTableQuery(ti, tc))
+					result.add(newModifyColumnChange(ti, tc, dbTc, fromDB.server))
 				}
 			}
 		}
 	}
 
+	buildCreateTableQueries(newTables, fromToml, result)
+
+	dropTables := []tableInfo{}
 	for _, ti := range fromDB.tables {
 		// DBにあってtomlにないテーブルはdelete
 		if _, exist := fromToml.tablesMap[ti.name]; !exist {
-			result.DropTables = append(result.DropTables, buildDropTableQuery(ti))
+			dropTables = append(dropTables, ti)
 			continue
 		}
 		if !reflect.DeepEqual(ti.columns, fromToml.tablesMap[ti.name].columns) {
 			for _, tc := range ti.columns {
 				if _, exist := fromToml.tablesMap[ti.name].columnsMap[tc.name]; !exist {
 					// DBにあってtomlにないカラムはdrop
-					result.DropColumns = append(result.DropColumns, buildDropColumnTableQuery(ti, tc))
+					result.add(newDropColumnChange(ti, tc))
 				}
 			}
 		}
 	}
+	buildDropTableQueries(dropTables, fromDB, result)
+}
+
+// charset, collationを指定していない文字列のカラムはDBのものを引き継ぐ
+// MODIFY COLUMNで指定しないとテーブルのデフォルトに戻ってしまうため
+// 片方だけ指定している場合はもう片方が一致するときだけ引き継ぐ
+func inheritColumnCharset(tc, dbTc tableColumn) tableColumn {
+	if !isCharsetType(tc.columnType) {
+		return tc
+	}
+	switch {
+	case tc.charset == "" && tc.collation == "":
+		tc.charset = dbTc.charset
+		tc.collation = dbTc.collation
+	case tc.collation == "" && tc.charset == dbTc.charset:
+		tc.collation = dbTc.collation
+	case tc.charset == "" && tc.collation == dbTc.collation:
+		tc.charset = dbTc.charset
+	}
+
+	return tc
+}
+
+func isCharsetType(columnType string) bool {
+	switch columnType {
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext", "enum", "set":
+		return true
+	}
+
+	return false
+}
+
+// columnMoves 両方にあるカラムの並び順をtomlに合わせるために移動が必要なカラムと、その移動先の直前のカラム名(先頭の場合は空文字)
+// 並び順が既に合っている最長のカラム列(最長増加部分列)は動かさないので移動は最小回数になる
+// 追加するカラムは移動が終わってから直前のカラムの後ろに追加するので、ここでは両方にあるカラムだけを見る
+func columnMoves(ti, dbTi tableInfo) (result map[string]string) {
+	result = map[string]string{}
+
+	dbPositions := map[string]int{}
+	for idx, tc := range dbTi.columns {
+		dbPositions[tc.name] = idx
+	}
+	common := []string{}
+	for _, tc := range ti.columns {
+		if _, exist := dbPositions[tc.name]; exist {
+			common = append(common, tc.name)
+		}
+	}
+
+	// lengths[i]: common[i]で終わる増加部分列の長さ、prev[i]: その1つ前
+	lengths := make([]int, len(common))
+	prev := make([]int, len(common))
+	last := -1
+	for i := range common {
+		lengths[i] = 1
+		prev[i] = -1
+		for j := 0; j < i; j++ {
+			if dbPositions[common[j]] < dbPositions[common[i]] && lengths[j]+1 > lengths[i] {
+				lengths[i] = lengths[j] + 1
+				prev[i] = j
+			}
+		}
+		if last == -1 || lengths[i] > lengths[last] {
+			last = i
+		}
+	}
+	keep := map[string]struct{}{}
+	for i := last; i != -1; i = prev[i] {
+		keep[common[i]] = struct{}{}
+	}
+
+	for idx, name := range common {
+		if _, exist := keep[name]; exist {
+			continue
+		}
+		var beforeColumnName string
+		if idx != 0 {
+			beforeColumnName = common[idx-1]
+		}
+		result[name] = beforeColumnName
+	}
+
+	return
+}
+
+// tomlでengineを指定していないテーブルは既存のMroongaやMyISAMのテーブルを変えてしまわないように比較しない
+func procEngineDiff(fromToml, fromDB schema, result *Queries) {
+	for _, ti := range fromToml.tables {
+		dbTi, exist := fromDB.tablesMap[ti.name]
+		if !exist || dbTi.engine == "" || ti.engine == "" {
+			continue
+		}
+		option := ti.engineOption
+		if !isMroonga(ti.engine) {
+			option = engineOption{}
+		}
+		if ti.engine != dbTi.engine || !reflect.DeepEqual(option, dbTi.engineOption) {
+			result.add(newEngineChange(ti, ti.engine, option, dbTi.engineOption))
+		}
+	}
+}
+
+// tomlで指定しているテーブルオプションのうちDBと違うものをALTER TABLEする
+func procTableOptionDiff(fromToml, fromDB schema, result *Queries) {
+	for _, ti := range fromToml.tables {
+		dbTi, exist := fromDB.tablesMap[ti.name]
+		if !exist {
+			continue
+		}
+		for _, clause := range buildTableOptionClauses(diffTableOption(ti.tableOption, dbTi.tableOption)) {
+			result.add(newTableOptionChange(ti, clause))
+		}
+	}
+}
+
+// optionで指定していてdbOptionと違うものだけのtableOption
+// AUTO_INCREMENTは既に使われている値より小さくはできないのでDBの値の方が小さい場合のみ
+func diffTableOption(option, dbOption tableOption) (result tableOption) {
+	if (option.charset != "" && option.charset != dbOption.charset) || (option.collation != "" && option.collation != dbOption.collation) {
+		result.charset = option.charset
+		result.collation = option.collation
+	}
+	if option.comment != "" && option.comment != dbOption.comment {
+		result.comment = option.comment
+	}
+	if option.rowFormat != "" && option.rowFormat != dbOption.rowFormat {
+		result.rowFormat = option.rowFormat
+	}
+	if option.keyBlockSize != "" && option.keyBlockSize != dbOption.keyBlockSize {
+		result.keyBlockSize = option.keyBlockSize
+	}
+	if option.statsPersistent != "" && option.statsPersistent != dbOption.statsPersistent {
+		result.statsPersistent = option.statsPersistent
+	}
+	if option.autoIncrement != "" && dbOption.autoIncrement != "" {
+		autoIncrement, err := strconv.ParseUint(option.autoIncrement, 10, 64)
+		dbAutoIncrement, dbErr := strconv.ParseUint(dbOption.autoIncrement, 10, 64)
+		if err == nil && dbErr == nil && dbAutoIncrement < autoIncrement {
+			result.autoIncrement = option.autoIncrement
+		}
+	}
+
+	return
+}
+
+// CREATE TABLE, ALTER TABLEのテーブルオプション charsetとcollationは1つにする
+func buildTableOptionClauses(option tableOption) (result []string) {
+	charset := []string{}
+	if option.charset != "" {
+		charset = append(charset, fmt.Sprintf("DEFAULT CHARSET=%v", option.charset))
+	}
+	if option.collation != "" {
+		charset = append(charset, fmt.Sprintf("COLLATE=%v", option.collation))
+	}
+	if len(charset) > 0 {
+		result = append(result, strings.Join(charset, " "))
+	}
+	if option.rowFormat != "" {
+		result = append(result, fmt.Sprintf("ROW_FORMAT=%v", option.rowFormat))
+	}
+	if option.keyBlockSize != "" {
+		result = append(result, fmt.Sprintf("KEY_BLOCK_SIZE=%v", option.keyBlockSize))
+	}
+	if option.statsPersistent != "" {
+		result = append(result, fmt.Sprintf("STATS_PERSISTENT=%v", option.statsPersistent))
+	}
+	if option.autoIncrement != "" {
+		result = append(result, fmt.Sprintf("AUTO_INCREMENT=%v", option.autoIncrement))
+	}
+	if option.comment != "" {
+		result = append(result, fmt.Sprintf("COMMENT='%v'", strings.ReplaceAll(option.comment, "'", "''")))
+	}
+
+	return
+}
+
+// tokenizerを指定しない場合のtokenizer
+const defaultFullTextTokenizer = "TokenBigramSplitSymbolAlphaDigit"
+
+func isMroonga(engine string) bool {
+	return engine == "Mroonga"
+}
+
+// tomlでengineを指定していない場合はDBのデフォルト
+func tableEngine(ti tableInfo, server serverInfo) string {
+	if ti.engine == "" {
+		return server.defaultEngine
+	}
+
+	return ti.engine
+}
+
+// fulltext indexのオプションをテーブルのengineで使うものだけにする
+// MroongaはCOMMENTのtokenizerなど、それ以外はWITH PARSERのみ
+func resolveFullTextOptions(fromToml schema, defaultEngine string) {
+	for _, ti := range fromToml.tables {
+		engine := ti.engine
+		if engine == "" {
+			engine = defaultEngine
+		}
+		for _, ii := range fromToml.indexInfosMap[ti.name] {
+			if ii.indexType != "FULLTEXT" {
+				continue
+			}
+			if isMroonga(engine) {
+				ii.fulltext.parser = ""
+				// テーブルのdefault_tokenizerがある場合はそれを使う
+				if ii.fulltext.tokenizer == "" && ti.engineOption.defaultTokenizer == "" {
+					ii.fulltext.tokenizer = defaultFullTextTokenizer
+				}
+			} else {
+				ii.fulltext = fulltextOption{parser: ii.fulltext.parser}
+			}
+		}
+	}
+}
+
+// 外部キーの親テーブルが先に作成されるように並べてCREATEする
+// 循環参照していて並べられない場合は解決できなかった外部キーだけCREATE後にADDする
+func buildCreateTableQueries(newTables []tableInfo, fromToml schema, result *Queries) {
+	pending := map[string]struct{}{}
+	for _, ti := range newTables {
+		pending[ti.name] = struct{}{}
+	}
+
+	remaining := newTables
+	for len(remaining) > 0 {
+		rest := []tableInfo{}
+		for _, ti := range remaining {
+			if referencesPendingTable(ti, pending) {
+				rest = append(rest, ti)
+				continue
+			}
+			result.add(newCreateTableChange(ti, fromToml.indexInfosMap[ti.name]))
+			delete(pending, ti.name)
+		}
+		if len(rest) == len(remaining) {
+			// 循環参照しているので先頭のテーブルの外部キーを後回しにして作成する
+			ti := rest[0]
+			inlineFKs := []foreignKeyInfo{}
+			for _, fk := range ti.foreignKeys {
+				if _, exist := pending[fk.refTable]; exist && fk.refTable != ti.name {
+					result.add(newAddForeignKeyChange(fk))
+					continue
+				}
+				inlineFKs = append(inlineFKs, fk)
+			}
+			ti.foreignKeys = inlineFKs
+			result.add(newCreateTableChange(ti, fromToml.indexInfosMap[ti.name]))
+			delete(pending, ti.name)
+			rest = rest[1:]
+		}
+		remaining = rest
+	}
+}
+
+// 子テーブルが先にDROPされるように並べる
+// 循環参照していて並べられない場合は外部キーを先にDROPする
+func buildDropTableQueries(dropTables []tableInfo, fromDB schema, result *Queries) {
+	pending := map[string]tableInfo{}
+	for _, ti := range dropTables {
+		pending[ti.name] = ti
+	}
+
+	remaining := dropTables
+	for len(remaining) > 0 {
+		rest := []tableInfo{}
+		for _, ti := range remaining {
+			if referencedByPendingTable(ti.name, pending) {
+				rest = append(rest, ti)
+				continue
+			}
+			result.add(newDropTableChange(ti, fromDB.indexInfosMap[ti.name]))
+			delete(pending, ti.name)
+		}
+		if len(rest) == len(remaining) {
+			// 循環参照しているので先頭のテーブルを参照している外部キーを先にDROPする
+			ti := rest[0]
+			for _, child := range rest[1:] {
+				keptFKs := []foreignKeyInfo{}
+				for _, fk := range pending[child.name].foreignKeys {
+					if fk.refTable == ti.name {
+						result.add(newDropForeignKeyChange(fk))
+						continue
+					}
+					keptFKs = append(keptFKs, fk)
+				}
+				child.foreignKeys = keptFKs
+				pending[child.name] = child
+			}
+			result.add(newDropTableChange(ti, fromDB.indexInfosMap[ti.name]))
+			delete(pending, ti.name)
+			rest = rest[1:]
+		}
+		remaining = rest
+	}
+}
+
+func referencesPendingTable(ti tableInfo, pending map[string]struct{}) bool {
+	for _, fk := range ti.foreignKeys {
+		if fk.refTable == ti.name {
+			// 自己参照は問題ない
+			continue
+		}
+		if _, exist := pending[fk.refTable]; exist {
+			return true
+		}
+	}
+
+	return false
+}
+
+func referencedByPendingTable(tableName string, pending map[string]tableInfo) bool {
+	for childName, child := range pending {
+		if childName == tableName {
+			continue
+		}
+		for _, fk := range child.foreignKeys {
+			if fk.refTable == tableName {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// 新規テーブルの外部キーはCREATE時に作成しているのでここでは既存テーブルのみ扱う
+func procForeignKeyDiff(fromToml, fromDB schema, result *Queries) {
+	for _, ti := range fromToml.tables {
+		dbTi, exist := fromDB.tablesMap[ti.name]
+		if !exist {
+			continue
+		}
+		for _, fk := range ti.foreignKeys {
+			dbFK, exist := findForeignKey(dbTi.foreignKeys, fk.name)
+			if !exist {
+				result.add(newAddForeignKeyChange(fk))
+				continue
+			}
+			// 同一制約名で差分がある場合drop add
+			if !reflect.DeepEqual(fk, dbFK) {
+				result.add(newDropForeignKeyChange(dbFK))
+				result.add(newAddForeignKeyChange(fk))
+			}
+		}
+		for _, dbFK := range dbTi.foreignKeys {
+			if _, exist := findForeignKey(ti.foreignKeys, dbFK.name); !exist {
+				result.add(newDropForeignKeyChange(dbFK))
+			}
+		}
+	}
+}
+
+func findForeignKey(fks []foreignKeyInfo, name string) (foreignKeyInfo, bool) {
+	for _, fk := range fks {
+		if fk.name == name {
+			return fk, true
+		}
+	}
+
+	return foreignKeyInfo{}, false
+}
+
+// 外部キー作成時にmysqlが自動で作るindexは制約名と同名(古いものは先頭のカラム名)になる
+// tomlに書かれていなくてもdropしてはいけない
+// uniqueや名前を付けたindexはカラム構成が同じでも自分で作ったものなので含めない
+func isForeignKeyIndex(ti tableInfo, ii *indexInfo) bool {
+	if ii.unique {
+		return false
+	}
+	for _, fk := range ti.foreignKeys {
+		if ii.indexName == fk.name || (ii.indexName == fk.columns[0] && reflect.DeepEqual(ii.columns, fk.columns)) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // PRIMARY KEYはCreate時につける
@@ -71,32 +477,11 @@ func buildCreateTableQuery(ti tableInfo, indexInfosMap map[string]*indexInfo) st
 	columnQueries := []string{}
 	var primary string
 	for _, column := range ti.columns {
-		definition := []string{fmt.Sprintf("`%v`", column.name)}
-		if column.size == "" {
-			definition = append(definition, column.columnType)
-		} else {
-			definition = append(definition, fmt.Sprintf(`%v(%v)`, column.columnType, column.size))
-		}
-		if column.unsigned {
-			definition = append(definition, "UNSIGNED")
-		}
-		if !column.null {
-			definition = append(definition, "NOT NULL")
-		}
-		if column.defaultValue.need {
-			// TODO: 一旦()がついていれば関数とみなしてクォートはずす
-			if strings.Contains(column.defaultValue.value, "()") {
-				definition = append(definition, fmt.Sprintf(`DEFAULT %v`, column.defaultValue.value))
-			} else {
-				definition = append(definition, fmt.Sprintf(`DEFAULT '%v'`, column.defaultValue.value))
-			}
-		}
 		if column.autoInc {
 			// TODO: 一旦auto_incつきは強制でprimaryにする
-			definition = append(definition, "AUTO_INCREMENT")
 			primary = fmt.Sprintf(", PRIMARY KEY (`%v`)", column.name)
 		}
-		columnQueries = append(columnQueries, strings.Join(definition, " "))
+		columnQueries = append(columnQueries, buildColumnDefinition(column))
 	}
 	if ii, exist := indexInfosMap["PRIMARY"]; exist {
 		// primaryの指定がある場合はautoincより優先
@@ -106,161 +491,199 @@ func buildCreateTableQuery(ti tableInfo, indexInfosMap map[string]*indexInfo) st
 		}
 		primary = fmt.Sprintf(", PRIMARY KEY (%v)", strings.Join(escaped, ","))
 	}
-	result += strings.Join(columnQueries, ",") + primary + `)`
+	var foreignKeys string
+	for _, fk := range ti.foreignKeys {
+		foreignKeys += ", " + buildForeignKeyDefinition(fk)
+	}
+	result += strings.Join(columnQueries, ",") + primary + foreignKeys + `)`
 	if ti.engine != "" {
 		result += fmt.Sprintf(" ENGINE=%v", ti.engine)
 	}
+	result += buildEngineComment(ti.engineOption)
+	if options := buildTableOptionClauses(ti.tableOption); len(options) > 0 {
+		result += " " + strings.Join(options, " ")
+	}
 	if ti.partition.partitionType != "" {
-		result += fmt.Sprintf(" PARTITION BY %v (%v) (", ti.partition.partitionType, ti.partition.keyColumn)
-		startIDX, _ := strconv.Atoi(ti.partition.startNum)
-		endIDX, _ := strconv.Atoi(ti.partition.endNum)
-		eachRows, _ := strconv.Atoi(ti.partition.eachRow)
-		for i := startIDX; i <= endIDX; i++ {
-			var eachString string
-			if i == endIDX {
-				eachString = "maxvalue"
-			} else {
-				eachString = fmt.Sprintf("(%v)", strconv.Itoa(i*eachRows))
-			}
-			result += fmt.Sprintf(" PARTITION %v%v VALUES LESS THAN %v,", ti.partition.baseName, i, eachString)
-		}
-		result = strings.TrimRight(result, ",")
-		result += ")"
+		result += " " + buildPartitionByClause(ti.partition)
 	}
 
 	return result
 }
 
-func buildAddColumnTableQuery(ti tableInfo, tc tableColumn, beforeColumnName string) string {
-	result := fmt.Sprintf(`ALTER TABLE %v ADD COLUMN `, ti.name)
-	var position string
+func buildAddColumnClause(tc tableColumn, beforeColumnName string) string {
+	result := `ADD COLUMN `
+	result += buildColumnDefinition(tc) + fmt.Sprintf(" %v", buildColumnPosition(beforeColumnName))
+
+	return result
+}
+
+func buildModifyColumnClause(tc tableColumn) string {
+	return `MODIFY COLUMN ` + buildColumnDefinition(tc)
+}
+
+func buildMoveColumnClause(tc tableColumn, beforeColumnName string) string {
+	return buildModifyColumnClause(tc) + fmt.Sprintf(" %v", buildColumnPosition(beforeColumnName))
+}
+
+// beforeColumnNameが空の場合は先頭
+func buildColumnPosition(beforeColumnName string) string {
 	if beforeColumnName == "" {
-		position = "FIRST"
-	} else {
-		position = fmt.Sprintf("AFTER `%v`", beforeColumnName)
-	}
-	definition := []string{fmt.Sprintf("`%v`", tc.name)}
-	if tc.size == "" {
-		definition = append(definition, tc.columnType)
-	} else {
-		definition = append(definition, fmt.Sprintf(`%v(%v)`, tc.columnType, tc.size))
+		return "FIRST"
 	}
+
+	return fmt.Sprintf("AFTER `%v`", beforeColumnName)
+}
+
+// CREATE TABLE, ADD, MODIFY, CHANGE COLUMNで使うカラム定義
+func buildColumnDefinition(tc tableColumn) string {
+	definition := []string{fmt.Sprintf("`%v`", tc.name), buildColumnType(tc)}
 	if tc.unsigned {
 		definition = append(definition, "UNSIGNED")
 	}
+	definition = append(definition, buildColumnCharset(tc)...)
 	if !tc.null {
 		definition = append(definition, "NOT NULL")
 	}
 	if tc.defaultValue.need {
-		definition = append(definition, fmt.Sprintf(`DEFAULT '%v'`, tc.defaultValue.value))
+		definition = append(definition, buildColumnDefault(tc))
+	}
+	if tc.onUpdate != "" {
+		definition = append(definition, "ON UPDATE "+tc.onUpdate)
 	}
 	if tc.autoInc {
 		definition = append(definition, "AUTO_INCREMENT")
 	}
-	result += strings.Join(definition, " ") + fmt.Sprintf(" %v", position)
+	if tc.comment != "" {
+		definition = append(definition, buildColumnComment(tc))
+	}
 
-	return result
+	return strings.Join(definition, " ")
 }
 
-func buildModifyColumnTableQuery(ti tableInfo, tc tableColumn) string {
-	result := fmt.Sprintf(`ALTER TABLE %v MODIFY COLUMN `, ti.name)
-
-	definition := []string{fmt.Sprintf("`%v`", tc.name)}
-	if tc.size == "" {
-		definition = append(definition, tc.columnType)
-	} else {
-		definition = append(definition, fmt.Sprintf(`%v(%v)`, tc.columnType, tc.size))
+// e.g. int(11), enum('a','b')
+func buildColumnType(tc tableColumn) string {
+	if len(tc.values) > 0 {
+		return fmt.Sprintf(`%v(%v)`, tc.columnType, buildEnumValues(tc.values))
 	}
-	if tc.unsigned {
-		definition = append(definition, "UNSIGNED")
+	if tc.precision != "" && tc.scale != "" {
+		return fmt.Sprintf(`%v(%v,%v)`, tc.columnType, tc.precision, tc.scale)
 	}
-	if !tc.null {
-		definition = append(definition, "NOT NULL")
+	if tc.fsp != "" {
+		return fmt.Sprintf(`%v(%v)`, tc.columnType, tc.fsp)
 	}
-	if tc.defaultValue.need {
-		definition = append(definition, fmt.Sprintf(`DEFAULT '%v'`, tc.defaultValue.value))
+	if tc.size == "" {
+		return tc.columnType
 	}
-	if tc.autoInc {
-		definition = append(definition, "AUTO_INCREMENT")
+
+	return fmt.Sprintf(`%v(%v)`, tc.columnType, tc.size)
+}
+
+func buildColumnCharset(tc tableColumn) (result []string) {
+	if tc.charset != "" {
+		result = append(result, fmt.Sprintf("CHARACTER SET %v", tc.charset))
+	}
+	if tc.collation != "" {
+		result = append(result, fmt.Sprintf("COLLATE %v", tc.collation))
 	}
-	result += strings.Join(definition, " ")
 
-	return result
+	return
+}
+
+func buildColumnComment(tc tableColumn) string {
+	return fmt.Sprintf("COMMENT '%v'", strings.ReplaceAll(tc.comment, "'", "''"))
 }
 
 func buildDropTableQuery(ti tableInfo) string {
 	return fmt.Sprintf(`DROP TABLE %v`, ti.name)
 }
 
-func buildDropColumnTableQuery(ti tableInfo, tc tableColumn) string {
-	return fmt.Sprintf(`ALTER TABLE %v DROP COLUMN %v`, ti.name, tc.name)
+func buildDropColumnClause(tc tableColumn) string {
+	return fmt.Sprintf(`DROP COLUMN %v`, tc.name)
 }
 
 func procIndexDiff(fromToml, fromDB schema, result *Queries) {
-	newTables := map[string]struct{}{}
-
-	for tableName, sortedIDXes := range fromToml.indexInfosSlice {
-		if _, exist := fromDB.indexInfosMap[tableName]; !exist {
-			// 新規テーブル
-			newTables[tableName] = struct{}{}
+	for _, ti := range fromToml.tables {
+		dbTi, existTable := fromDB.tablesMap[ti.name]
+		if existTable {
+			procPrimaryKeyDiff(ti, dbTi, fromToml, fromDB, result)
 		}
-		for _, idxName := range sortedIDXes {
-			// tomlにあってDBにないindexはadd
+		for _, idxName := range fromToml.indexInfosSlice[ti.name] {
 			// Create時にPRIMARYは作成するため新規テーブルのときはprimaryはスルー
-			if _, exist := newTables[tableName]; exist && idxName == "PRIMARY" {
+			// 既存テーブルのprimaryはprocPrimaryKeyDiffで扱う
+			if idxName == "PRIMARY" {
 				continue
 			}
-			ii := fromToml.indexInfosMap[tableName][idxName]
-			if _, exist := fromDB.indexInfosMap[tableName]; !exist {
+			// tomlにあってDBにないindexはadd
+			ii := fromToml.indexInfosMap[ti.name][idxName]
+			if !existTable {
 				// 新規テーブル
-				result.AddIndexes = append(result.AddIndexes, buildAddIndexQuery(ii))
+				result.add(newAddIndexChange(ii))
 				continue
 			}
-			if _, exist := fromDB.indexInfosMap[tableName][idxName]; !exist {
+			dbII, exist := fromDB.indexInfosMap[ti.name][idxName]
+			if !exist {
 				// idx追加
-				result.AddIndexes = append(result.AddIndexes, buildAddIndexQuery(ii))
+				result.add(newAddIndexChange(ii))
 				continue
 			}
 			// 同一index名で差分がある場合delete add
-			if _, exist := fromDB.indexInfosMap[tableName]; exist {
-				if !reflect.DeepEqual(ii, fromDB.indexInfosMap[tableName][idxName]) {
-					result.DropIndexes = append(result.DropIndexes, buildDeleteIndexQuery(fromDB.indexInfosMap[tableName][idxName]))
-					result.AddIndexes = append(result.AddIndexes, buildAddIndexQuery(ii))
-				}
+			if !reflect.DeepEqual(ii, dbII) {
+				result.add(newDropIndexChange(dbII, ti, dbTi))
+				result.add(newAddIndexChange(ii))
 			}
 		}
 	}
 
-	for tableName, idxesMap := range fromDB.indexInfosMap {
-		for idxName, ii := range idxesMap {
-			// DBにあってtomlにないindexはdrop
-			if _, exist := fromToml.indexInfosMap[tableName]; !exist {
-				// DBにテーブルがあってtomlにないのはdrop対象テーブルなのでスルー
+	for _, ti := range fromDB.tables {
+		if _, exist := fromToml.tablesMap[ti.name]; !exist {
+			// DBにテーブルがあってtomlにないのはdrop対象テーブルなのでスルー
+			continue
+		}
+		// DBにあってtomlにないindexはdrop
+		for _, idxName := range fromDB.indexInfosSlice[ti.name] {
+			if _, exist := fromToml.indexInfosMap[ti.name][idxName]; exist || idxName == "PRIMARY" {
 				continue
 			}
-			if _, exist := fromToml.indexInfosMap[tableName][idxName]; !exist {
-				result.DropIndexes = append(result.DropIndexes, buildDeleteIndexQuery(ii))
+			ii := fromDB.indexInfosMap[ti.name][idxName]
+			if isForeignKeyIndex(fromToml.tablesMap[ti.name], ii) {
+				continue
 			}
+			result.add(newDropIndexChange(ii, fromToml.tablesMap[ti.name], ti))
 		}
 	}
+}
 
-	for tableName, sortedIDXes := range fromDB.indexInfosSlice {
-		if _, exist := fromToml.indexInfosMap[tableName]; !exist {
-			// DBにテーブルがあってtomlにないのはdrop対象テーブルなのでスルー
-			continue
-		}
-		// DBにあってtomlにないindexはdrop
-		for _, idxName := range sortedIDXes {
-			if _, exist := fromToml.indexInfosMap[tableName][idxName]; !exist {
-				result.DropIndexes = append(result.DropIndexes, buildDeleteIndexQuery(fromDB.indexInfosMap[tableName][idxName]))
-			}
+// PRIMARY KEYは付け替えをDROP PRIMARY KEY, ADD PRIMARY KEYの1文で行う
+func procPrimaryKeyDiff(ti, dbTi tableInfo, fromToml, fromDB schema, result *Queries) {
+	pk, exist := fromToml.indexInfosMap[ti.name]["PRIMARY"]
+	dbPK, dbExist := fromDB.indexInfosMap[ti.name]["PRIMARY"]
+	switch {
+	case exist && dbExist:
+		if !reflect.DeepEqual(pk, dbPK) {
+			result.add(newPrimaryKeyChange(ti, dbTi, dbPK, pk))
 		}
+	case exist:
+		result.add(newPrimaryKeyChange(ti, dbTi, nil, pk))
+	case dbExist:
+		result.add(newPrimaryKeyChange(ti, dbTi, dbPK, nil))
+	}
+}
+
+func buildPrimaryKeyClause(dbPK, pk *indexInfo) string {
+	clauses := []string{}
+	if dbPK != nil {
+		clauses = append(clauses, "DROP PRIMARY KEY")
+	}
+	if pk != nil {
+		clauses = append(clauses, fmt.Sprintf("ADD PRIMARY KEY (%v)", escapeColumns(pk.columns)))
 	}
+
+	return strings.Join(clauses, ", ")
 }
 
-func buildAddIndexQuery(ii *indexInfo) string {
+func buildAddIndexClause(ii *indexInfo) string {
 	if ii.indexType == "FULLTEXT" {
-		return buildFullTextAddQuery(ii)
+		return buildFullTextAddClause(ii)
 	}
 
 	var indexType string
@@ -276,19 +699,335 @@ func buildAddIndexQuery(ii *indexInfo) string {
 	}
 	columns = strings.TrimRight(columns, ",")
 
-	return fmt.Sprintf(`ALTER TABLE %v ADD %v %v (%v)`, ii.tableName, indexType, ii.indexName, columns)
+	return fmt.Sprintf(`ADD %v %v (%v)`, indexType, ii.indexName, columns)
 }
 
-func buildFullTextAddQuery(ii *indexInfo) string {
+func buildFullTextAddClause(ii *indexInfo) string {
 	var columns string
 	for _, column := range ii.columns {
 		columns += "`" + column + "`,"
 	}
 	columns = strings.TrimRight(columns, ",")
 
-	return fmt.Sprintf(`ALTER TABLE %v ADD %v %v (%v) COMMENT %v`, ii.tableName, "FULLTEXT KEY", ii.indexName, columns, ii.comment)
+	if ii.fulltext.parser != "" {
+		return fmt.Sprintf(`ADD %v %v (%v) WITH PARSER %v`, "FULLTEXT KEY", ii.indexName, columns, ii.fulltext.parser)
+	}
+
+	return fmt.Sprintf(`ADD %v %v (%v)%v`, "FULLTEXT KEY", ii.indexName, columns, buildFullTextComment(ii.fulltext))
+}
+
+// Mroongaのラッパーモードのengine, default_tokenizerなどのテーブルのCOMMENT
+func buildEngineComment(option engineOption) string {
+	options := []string{}
+	if option.wrappedEngine != "" {
+		options = append(options, fmt.Sprintf(`engine "%v"`, option.wrappedEngine))
+	}
+	if option.defaultTokenizer != "" {
+		options = append(options, fmt.Sprintf(`default_tokenizer "%v"`, option.defaultTokenizer))
+	}
+	if option.normalizer != "" {
+		options = append(options, fmt.Sprintf(`normalizer "%v"`, option.normalizer))
+	}
+	if len(option.tokenFilters) > 0 {
+		options = append(options, fmt.Sprintf(`token_filters "%v"`, strings.Join(option.tokenFilters, ",")))
+	}
+	if len(options) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(` COMMENT='%v'`, strings.ReplaceAll(strings.Join(options, ", "), "'", "''"))
+}
+
+// Mroongaのtokenizer, normalizer, token_filtersのCOMMENT
+func buildFullTextComment(fulltext fulltextOption) string {
+	options := []string{}
+	if fulltext.tokenizer != "" {
+		options = append(options, fmt.Sprintf(`tokenizer "%v"`, fulltext.tokenizer))
+	}
+	if fulltext.normalizer != "" {
+		options = append(options, fmt.Sprintf(`normalizer "%v"`, fulltext.normalizer))
+	}
+	if len(fulltext.tokenFilters) > 0 {
+		options = append(options, fmt.Sprintf(`token_filters "%v"`, strings.Join(fulltext.tokenFilters, ",")))
+	}
+	if len(options) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(` COMMENT '%v'`, strings.ReplaceAll(strings.Join(options, ", "), "'", "''"))
+}
+
+func buildDeleteIndexClause(ii *indexInfo) string {
+	return fmt.Sprintf(`DROP INDEX %v`, ii.indexName)
+}
+
+func buildForeignKeyDefinition(fk foreignKeyInfo) string {
+	result := fmt.Sprintf("CONSTRAINT `%v` FOREIGN KEY (%v) REFERENCES `%v` (%v)", fk.name, escapeColumns(fk.columns), fk.refTable, escapeColumns(fk.refColumns))
+	// RESTRICTはデフォルトなので省略
+	if fk.onDelete != "RESTRICT" {
+		result += " ON DELETE " + fk.onDelete
+	}
+	if fk.onUpdate != "RESTRICT" {
+		result += " ON UPDATE " + fk.onUpdate
+	}
+
+	return result
+}
+
+func buildAddForeignKeyClause(fk foreignKeyInfo) string {
+	return fmt.Sprintf(`ADD %v`, buildForeignKeyDefinition(fk))
+}
+
+func buildDropForeignKeyClause(fk foreignKeyInfo) string {
+	return fmt.Sprintf("DROP FOREIGN KEY `%v`", fk.name)
+}
+
+func escapeColumns(columns []string) string {
+	escaped := []string{}
+	for _, column := range columns {
+		escaped = append(escaped, fmt.Sprintf("`%v`", column))
+	}
+
+	return strings.Join(escaped, ",")
 }
 
-func buildDeleteIndexQuery(ii *indexInfo) string {
-	return fmt.Sprintf(`ALTER TABLE %v DROP INDEX %v`, ii.tableName, ii.indexName)
+func newCreateTableChange(ti tableInfo, indexInfosMap map[string]*indexInfo) *ddlChange {
+	result := &ddlChange{phase: phaseCreateTable, tableName: ti.name, query: buildCreateTableQuery(ti, indexInfosMap)}
+	result.creates = append(result.creates, tableKey(ti.name))
+	for _, column := range ti.columns {
+		result.creates = append(result.creates, columnKey(ti.name, column.name))
+		if column.autoInc {
+			result.creates = append(result.creates, keyKey(ti.name, []string{column.name}))
+		}
+	}
+	if ii, exist := indexInfosMap["PRIMARY"]; exist {
+		result.creates = append(result.creates, keyKey(ti.name, ii.columns))
+	}
+	for _, fk := range ti.foreignKeys {
+		result.creates = append(result.creates, foreignKeyKey(ti.name, fk.name), keyKey(ti.name, fk.columns))
+		if fk.refTable == ti.name {
+			continue
+		}
+		result.needs = append(result.needs, tableKey(fk.refTable), keyKey(fk.refTable, fk.refColumns))
+		result.needs = append(result.needs, columnKeys(fk.refTable, fk.refColumns)...)
+	}
+
+	return result
+}
+
+func newDropTableChange(ti tableInfo, indexInfosMap map[string]*indexInfo) *ddlChange {
+	result := &ddlChange{phase: phaseDropTable, tableName: ti.name, query: buildDropTableQuery(ti)}
+	result.drops = append(result.drops, tableKey(ti.name))
+	result.drops = append(result.drops, columnKeys(ti.name, columnNames(ti.columns))...)
+	for _, ii := range indexInfosMap {
+		result.drops = append(result.drops, indexKey(ti.name, ii.indexName), keyKey(ti.name, ii.columns))
+	}
+	for _, fk := range ti.foreignKeys {
+		result.drops = append(result.drops, foreignKeyKey(ti.name, fk.name))
+		if fk.refTable == ti.name {
+			continue
+		}
+		result.releases = append(result.releases, tableKey(fk.refTable), keyKey(fk.refTable, fk.refColumns))
+		result.releases = append(result.releases, columnKeys(fk.refTable, fk.refColumns)...)
+	}
+
+	return result
+}
+
+// atEndは既存のカラムより後ろに追加される場合
+func newAddColumnChange(ti tableInfo, tc tableColumn, beforeColumnName string, atEnd bool) *ddlChange {
+	result := &ddlChange{phase: phaseAddColumn, op: opAddColumn, tableName: ti.name, clause: buildAddColumnClause(tc, beforeColumnName)}
+	result.needs = append(result.needs, columnOrderKey(ti.name))
+	if tc.autoInc {
+		result.op = opAddAutoIncColumn
+		result.needs = append(result.needs, leadingKey(ti.name, tc.name))
+	} else if atEnd {
+		result.op = opAppendColumn
+	}
+	result.needs = append(result.needs, tableKey(ti.name))
+	if beforeColumnName != "" {
+		result.needs = append(result.needs, columnKey(ti.name, beforeColumnName))
+	}
+	result.creates = append(result.creates, columnKey(ti.name, tc.name))
+
+	return result
+}
+
+// 変更の種類はDBと同じ表記にしたカラムで判定する
+func newModifyColumnChange(ti tableInfo, tc, dbTc tableColumn, server serverInfo) *ddlChange {
+	result := &ddlChange{phase: phaseModifyColumn, op: classifyModify(dbTc, canonicalizeColumn(tc, server)), tableName: ti.name, clause: buildModifyColumnClause(tc)}
+	// 定義を作り直すのでこのカラムに依存しているものは先に削除、後で作成する
+	result.needs = append(result.needs, columnKey(ti.name, tc.name))
+	result.drops = append(result.drops, columnKey(ti.name, tc.name))
+	result.creates = append(result.creates, columnKey(ti.name, tc.name))
+	if tc.autoInc && !dbTc.autoInc {
+		// AUTO_INCREMENTにするにはそのカラムが先頭のindexが必要
+		result.needs = append(result.needs, leadingKey(ti.name, tc.name))
+	} else if !tc.autoInc && dbTc.autoInc {
+		// AUTO_INCREMENTを外すまでそのカラムが先頭のindexは消せない
+		result.releases = append(result.releases, leadingKey(ti.name, tc.name))
+	}
+
+	return result
+}
+
+// 移動と同時に定義も変更する
+func newMoveColumnChange(ti tableInfo, tc, dbTc tableColumn, beforeColumnName string, server serverInfo) *ddlChange {
+	result := newModifyColumnChange(ti, tc, dbTc, server)
+	result.clause = buildMoveColumnClause(tc, beforeColumnName)
+	if result.op != opModifyColumn {
+		result.op = opMoveColumn
+	}
+	if beforeColumnName != "" {
+		result.needs = append(result.needs, columnKey(ti.name, beforeColumnName))
+	}
+	// カラムの追加は移動が終わってから行う
+	result.creates = append(result.creates, columnOrderKey(ti.name))
+
+	return result
+}
+
+// Mroongaのラッパーモードのengineなどを変える場合もENGINE=で作り直す
+// engine_optionsをなくす場合はCOMMENTを消さないとラッパーモードのままになる
+func newEngineChange(ti tableInfo, engine string, option, dbOption engineOption) *ddlChange {
+	comment := buildEngineComment(option)
+	if comment == "" && buildEngineComment(dbOption) != "" {
+		comment = " COMMENT=''"
+	}
+
+	return &ddlChange{phase: phaseEngine, op: opChangeEngine, tableName: ti.name, clause: fmt.Sprintf("ENGINE=%v", engine) + comment}
+}
+
+func newTableOptionChange(ti tableInfo, clause string) *ddlChange {
+	return &ddlChange{phase: phaseTableOption, op: opTableOption, tableName: ti.name, clause: clause}
+}
+
+func newDropColumnChange(ti tableInfo, tc tableColumn) *ddlChange {
+	result := &ddlChange{phase: phaseDropColumn, op: opDropColumn, tableName: ti.name, clause: buildDropColumnClause(tc)}
+	result.drops = append(result.drops, columnKey(ti.name, tc.name))
+
+	return result
+}
+
+func newAddIndexChange(ii *indexInfo) *ddlChange {
+	result := &ddlChange{phase: phaseAddIndex, op: opAddIndex, tableName: ii.tableName, clause: buildAddIndexClause(ii)}
+	if ii.indexType == "FULLTEXT" {
+		result.op = opAddFullText
+	}
+	result.needs = append(result.needs, tableKey(ii.tableName))
+	result.needs = append(result.needs, columnKeys(ii.tableName, ii.columns)...)
+	result.creates = append(result.creates, indexKey(ii.tableName, ii.indexName), keyKey(ii.tableName, ii.columns), leadingKey(ii.tableName, ii.columns[0]))
+
+	return result
+}
+
+// tiはtoml側、dbTiはDB側のテーブル
+func newDropIndexChange(ii *indexInfo, ti, dbTi tableInfo) *ddlChange {
+	result := &ddlChange{phase: phaseDropIndex, op: opDropIndex, tableName: ii.tableName, clause: buildDeleteIndexClause(ii)}
+	result.drops = append(result.drops, indexKey(ii.tableName, ii.indexName), keyKey(ii.tableName, ii.columns), leadingKey(ii.tableName, ii.columns[0]))
+	result.releases = append(result.releases, columnKeys(ii.tableName, ii.columns)...)
+	if ti.columnsMap[ii.columns[0]].autoInc && dbTi.columnsMap[ii.columns[0]].autoInc {
+		// AUTO_INCREMENTのカラムが先頭のindexを消す場合は代わりのindexが必要
+		result.needs = append(result.needs, leadingKey(ii.tableName, ii.columns[0]))
+	}
+
+	return result
+}
+
+// dbPKがnilの場合はADD PRIMARY KEYのみ、pkがnilの場合はDROP PRIMARY KEYのみ
+func newPrimaryKeyChange(ti, dbTi tableInfo, dbPK, pk *indexInfo) *ddlChange {
+	result := &ddlChange{phase: phasePrimaryKey, op: opChangePrimaryKey, tableName: ti.name, clause: buildPrimaryKeyClause(dbPK, pk)}
+	var columns, dbColumns []string
+	if pk != nil {
+		columns = pk.columns
+		result.needs = append(result.needs, columnKeys(ti.name, columns)...)
+		result.creates = append(result.creates, indexKey(ti.name, "PRIMARY"), keyKey(ti.name, columns), leadingKey(ti.name, columns[0]))
+	} else {
+		result.op = opDropPrimaryKey
+	}
+	if dbPK != nil {
+		dbColumns = dbPK.columns
+		result.drops = append(result.drops, keyKey(ti.name, dbColumns))
+		for _, column := range dbColumns {
+			// 新しいPRIMARY KEYにも含まれるカラムは解放しない(MODIFYの後にPRIMARY KEYを付け替える)
+			if !containsName(columns, column) {
+				result.releases = append(result.releases, columnKey(ti.name, column))
+			}
+		}
+		leading := dbColumns[0]
+		if len(columns) == 0 || columns[0] != leading {
+			result.drops = append(result.drops, leadingKey(ti.name, leading))
+			if ti.columnsMap[leading].autoInc && dbTi.columnsMap[leading].autoInc {
+				// AUTO_INCREMENTのカラムが先頭でなくなる場合は代わりのindexが必要
+				result.needs = append(result.needs, leadingKey(ti.name, leading))
+			}
+		}
+	} else {
+		result.op = opAddPrimaryKey
+	}
+
+	return result
+}
+
+// bundleAutoIncKeys AUTO_INCREMENTのカラムは常にそのカラムが先頭のindexが必要で、
+// AUTO_INCREMENTの追加とindexの追加やindexの付け替えは別々のALTER TABLEでは実行できないので1つの変更にまとめる
+// AUTO_INCREMENTを外すMODIFYとそのカラムのindexの削除もお互いに相手の後になるので1つにまとめる
+func bundleAutoIncKeys(result *Queries) {
+	for i := 0; i < len(result.changes); i++ {
+		c := result.changes[i]
+		for _, key := range append(append([]string{}, c.needs...), c.releases...) {
+			if !strings.HasPrefix(key, "lead:") {
+				continue
+			}
+			released := !containsName(c.needs, key)
+			for j, other := range result.changes {
+				if j == i || c.clause == "" || other.clause == "" || other.tableName != c.tableName {
+					continue
+				}
+				if !released && !containsName(other.creates, key) {
+					continue
+				}
+				if released && !(containsName(other.drops, key) && intersects(other.releases, c.drops)) {
+					continue
+				}
+				c.bundle(other)
+				result.changes = append(result.changes[:j], result.changes[j+1:]...)
+				// まとめた結果もう一度見直す
+				i = -1
+				break
+			}
+			if i == -1 {
+				break
+			}
+		}
+	}
+}
+
+func newAddForeignKeyChange(fk foreignKeyInfo) *ddlChange {
+	result := &ddlChange{phase: phaseAddForeignKey, op: opAddForeignKey, tableName: fk.tableName, clause: buildAddForeignKeyClause(fk)}
+	result.needs = append(result.needs, tableKey(fk.tableName), tableKey(fk.refTable), keyKey(fk.tableName, fk.columns), keyKey(fk.refTable, fk.refColumns))
+	result.needs = append(result.needs, columnKeys(fk.tableName, fk.columns)...)
+	result.needs = append(result.needs, columnKeys(fk.refTable, fk.refColumns)...)
+	result.creates = append(result.creates, foreignKeyKey(fk.tableName, fk.name))
+
+	return result
+}
+
+func newDropForeignKeyChange(fk foreignKeyInfo) *ddlChange {
+	result := &ddlChange{phase: phaseDropForeignKey, op: opDropForeignKey, tableName: fk.tableName, clause: buildDropForeignKeyClause(fk)}
+	result.drops = append(result.drops, foreignKeyKey(fk.tableName, fk.name))
+	result.releases = append(result.releases, tableKey(fk.refTable), keyKey(fk.tableName, fk.columns), keyKey(fk.refTable, fk.refColumns))
+	result.releases = append(result.releases, columnKeys(fk.tableName, fk.columns)...)
+	result.releases = append(result.releases, columnKeys(fk.refTable, fk.refColumns)...)
+
+	return result
+}
+
+func columnNames(columns []tableColumn) []string {
+	result := []string{}
+	for _, column := range columns {
+		result = append(result, column.name)
+	}
+
+	return result
 }
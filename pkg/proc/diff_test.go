@@ -0,0 +1,401 @@
+package proc
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testDatabaseToml = `
+[database_test]
+name = "test"
+user = "root"
+pass = ""
+host = "localhost"
+port = "3306"
+`
+
+var testMySQL = serverInfo{flavor: "mysql", major: 8, minor: 0, patch: 34}
+var testMySQL57 = serverInfo{flavor: "mysql", major: 5, minor: 7, patch: 44}
+var testMariaDB = serverInfo{flavor: "mariadb", major: 10, minor: 6, patch: 12}
+
+func mustParseToml(t *testing.T, schemaToml string) schema {
+	t.Helper()
+	result, err := parseToml(testDatabaseToml+schemaToml, "test", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+// DB側もtomlから作る
+func mustPlan(t *testing.T, toToml, dbToml string, server serverInfo) []string {
+	t.Helper()
+	to := mustParseToml(t, toToml)
+	db := mustParseToml(t, dbToml)
+	db.server = server
+	result, err := planDDL(procDiff(to, db), to, server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestProcDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		toml   string
+		db     string
+		server serverInfo
+		want   []string
+	}{
+		{
+			name: "drop primary key with auto_increment",
+			toml: `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "x", type = "int", null = true}]
+`,
+			db: `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int", autoinc = true}, {name = "x", type = "int", null = true}]
+primary = ["id"]
+`,
+			server: testMySQL,
+			want:   []string{"ALTER TABLE a MODIFY COLUMN `id` int(11) NOT NULL, DROP PRIMARY KEY"},
+		},
+		{
+			name: "mariadb json is longtext",
+			toml: `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "j", type = "json", null = true}]
+`,
+			db: `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "j", type = "longtext", null = true, charset = "utf8mb4", collation = "utf8mb4_bin"}]
+`,
+			server: testMariaDB,
+		},
+		{
+			name: "expression default written differently",
+			toml: `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "d", type = "date", default_expr = "(CAST(NOW() AS DATE))"}]
+`,
+			db: `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "d", type = "date", default_expr = "cast(now() as date)"}]
+`,
+			server: testMySQL,
+		},
+		{
+			name: "undeclared engine keeps the existing engine",
+			toml: `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}]
+`,
+			db: `
+[[tables]]
+name = "a"
+engine = "MyISAM"
+columns = [{name = "id", type = "int"}]
+`,
+			server: serverInfo{flavor: "mysql", major: 8, minor: 0, patch: 34, defaultEngine: "InnoDB"},
+		},
+		{
+			name: "declared engine",
+			toml: `
+[[tables]]
+name = "a"
+engine = "InnoDB"
+columns = [{name = "id", type = "int"}]
+`,
+			db: `
+[[tables]]
+name = "a"
+engine = "MyISAM"
+columns = [{name = "id", type = "int"}]
+`,
+			server: serverInfo{flavor: "mysql", major: 8, minor: 0, patch: 34, defaultEngine: "InnoDB"},
+			want:   []string{"ALTER TABLE a ENGINE=InnoDB"},
+		},
+		{
+			name: "remove mroonga engine_options",
+			toml: `
+[[tables]]
+name = "a"
+engine = "Mroonga"
+columns = [{name = "id", type = "int"}]
+`,
+			db: `
+[[tables]]
+name = "a"
+engine = "Mroonga"
+engine_options = {engine = "InnoDB"}
+columns = [{name = "id", type = "int"}]
+`,
+			server: testMariaDB,
+			want:   []string{"ALTER TABLE a ENGINE=Mroonga COMMENT=''"},
+		},
+		{
+			name: "mroonga without engine_options",
+			toml: `
+[[tables]]
+name = "a"
+engine = "Mroonga"
+columns = [{name = "id", type = "int"}]
+`,
+			db: `
+[[tables]]
+name = "a"
+engine = "Mroonga"
+columns = [{name = "id", type = "int"}]
+`,
+			server: testMariaDB,
+		},
+		{
+			name: "change column keeps charset",
+			toml: `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "title", type = "varchar", size = "20", renamed_from = "name"}]
+`,
+			db: `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "name", type = "varchar", size = "20", charset = "latin1", collation = "latin1_swedish_ci"}]
+`,
+			server: testMySQL57,
+			want:   []string{"ALTER TABLE a CHANGE COLUMN `name` `title` varchar(20) CHARACTER SET latin1 COLLATE latin1_swedish_ci NOT NULL"},
+		},
+		{
+			name: "rename column",
+			toml: `
+[options]
+merge_alter = true
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "title", type = "varchar", size = "20", renamed_from = "name"}]
+`,
+			db: `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "name", type = "varchar", size = "20"}]
+`,
+			server: testMySQL,
+			want:   []string{"ALTER TABLE a RENAME COLUMN `name` TO `title`"},
+		},
+		{
+			name: "rename and modify column with merge_alter",
+			toml: `
+[options]
+merge_alter = true
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "x", type = "int", null = true}, {name = "title", type = "varchar", size = "40", renamed_from = "name"}]
+`,
+			db: `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "name", type = "varchar", size = "20"}]
+`,
+			server: testMySQL,
+			want:   []string{"ALTER TABLE a CHANGE COLUMN `name` `title` varchar(40) NOT NULL, ADD COLUMN `x` int(11) AFTER `id`"},
+		},
+		{
+			name: "rename column and add index with merge_alter",
+			toml: `
+[options]
+merge_alter = true
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "title", type = "varchar", size = "20", renamed_from = "name"}]
+index = ["title"]
+`,
+			db: `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "name", type = "varchar", size = "20"}]
+`,
+			server: testMySQL,
+			want: []string{
+				"ALTER TABLE a RENAME COLUMN `name` TO `title`",
+				"ALTER TABLE a ADD INDEX idx_a_title (`title`)",
+			},
+		},
+		{
+			name: "drop declared index on foreign key columns",
+			toml: `
+[[tables]]
+name = "p"
+columns = [{name = "id", type = "int"}]
+primary = ["id"]
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "pid", type = "int", null = true}]
+index = ["id"]
+foreign_keys = [{columns = "pid", ref_table = "p", ref_columns = "id"}]
+`,
+			db: `
+[[tables]]
+name = "p"
+columns = [{name = "id", type = "int"}]
+primary = ["id"]
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "pid", type = "int", null = true}]
+index = ["id"]
+unique_index = ["pid"]
+foreign_keys = [{columns = "pid", ref_table = "p", ref_columns = "id"}]
+`,
+			server: testMySQL,
+			want:   []string{"ALTER TABLE a DROP INDEX idx_a_pid"},
+		},
+		{
+			name: "partition with algorithm",
+			toml: `
+[options]
+merge_alter = true
+algorithm = "AUTO"
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "x", type = "int", null = true}]
+primary = ["id"]
+index = ["x"]
+partition = {type = "hash", key = "id", partitions = "4"}
+`,
+			db: `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}]
+primary = ["id"]
+`,
+			server: testMySQL,
+			want: []string{
+				"ALTER TABLE a ADD COLUMN `x` int(11) AFTER `id`, ADD INDEX idx_a_x (`x`), ALGORITHM=INPLACE",
+				"ALTER TABLE a ALGORITHM=COPY PARTITION BY hash (id) PARTITIONS 4",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mustPlan(t, tt.toml, tt.db, tt.server)
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsForeignKeyIndex(t *testing.T) {
+	ti := tableInfo{name: "a", foreignKeys: []foreignKeyInfo{{tableName: "a", name: "fk_a_pid", columns: []string{"pid"}, refTable: "p", refColumns: []string{"id"}}}}
+	tests := []struct {
+		name string
+		ii   *indexInfo
+		want bool
+	}{
+		{"named after constraint", &indexInfo{tableName: "a", indexName: "fk_a_pid", columns: []string{"pid"}}, true},
+		{"named after column", &indexInfo{tableName: "a", indexName: "pid", columns: []string{"pid"}}, true},
+		{"declared index", &indexInfo{tableName: "a", indexName: "idx_a_pid", columns: []string{"pid"}}, false},
+		{"declared unique index", &indexInfo{tableName: "a", unique: true, indexName: "pid", columns: []string{"pid"}}, false},
+		{"other columns", &indexInfo{tableName: "a", indexName: "x", columns: []string{"x"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isForeignKeyIndex(ti, tt.ii); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenameTableKeepsForeignKeyNames(t *testing.T) {
+	toml := `
+[[tables]]
+name = "p"
+columns = [{name = "id", type = "int"}]
+primary = ["id"]
+[[tables]]
+name = "b"
+renamed_from = "a"
+columns = [{name = "id", type = "int"}, {name = "pid", type = "int", null = true}]
+primary = ["id"]
+foreign_keys = [{columns = "pid", ref_table = "p", ref_columns = "id"}]
+`
+	tests := []struct {
+		name   string
+		dbName string
+		want   []string
+	}{
+		{"rename", "a", []string{"RENAME TABLE a TO b"}},
+		// RENAME後は外部キー名だけが古いまま
+		{"renamed", "b", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			to := mustParseToml(t, toml)
+			db := mustParseToml(t, `
+[[tables]]
+name = "p"
+columns = [{name = "id", type = "int"}]
+primary = ["id"]
+[[tables]]
+name = "`+tt.dbName+`"
+columns = [{name = "id", type = "int"}, {name = "pid", type = "int", null = true}]
+primary = ["id"]
+foreign_keys = [{name = "fk_a_pid", columns = "pid", ref_table = "p", ref_columns = "id"}]
+`)
+			db.server = testMySQL
+			// 外部キーの作成時にmysqlが自動で作るindex
+			db.indexInfosSlice[tt.dbName] = append(db.indexInfosSlice[tt.dbName], "fk_a_pid")
+			db.indexInfosMap[tt.dbName]["fk_a_pid"] = &indexInfo{tableName: tt.dbName, indexName: "fk_a_pid", indexType: "BTREE", columns: []string{"pid"}}
+			got, err := planDDL(procDiff(to, db), to, testMySQL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if to.tablesMap["b"].foreignKeys[0].name != "fk_b_pid" {
+				t.Errorf("toml schema was modified: %v", to.tablesMap["b"].foreignKeys[0].name)
+			}
+		})
+	}
+}
+
+func TestColumnMoves(t *testing.T) {
+	columns := func(names ...string) (result []tableColumn) {
+		for _, name := range names {
+			result = append(result, tableColumn{name: name})
+		}
+		return
+	}
+	tests := []struct {
+		name string
+		toml []tableColumn
+		db   []tableColumn
+		want map[string]string
+	}{
+		{"same order", columns("a", "b", "c"), columns("a", "b", "c"), map[string]string{}},
+		{"move to first", columns("c", "a", "b"), columns("a", "b", "c"), map[string]string{"c": ""}},
+		{"move one", columns("a", "c", "b", "d"), columns("a", "b", "c", "d"), map[string]string{"b": "c"}},
+		{"added and dropped columns are ignored", columns("x", "b", "a"), columns("a", "b", "y"), map[string]string{"a": "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := columnMoves(tableInfo{columns: tt.toml}, tableInfo{columns: tt.db}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -24,6 +24,10 @@ func ExportToml(schemaToml, env, settingToml string, useEmbed bool) (err error)
 	for tableName, sortedIDXes := range fromDB.indexInfosSlice {
 		for _, idxName := range sortedIDXes {
 			ii := fromDB.indexInfosMap[tableName][idxName]
+			if idxName != "PRIMARY" && isForeignKeyIndex(fromDB.tablesMap[tableName], ii) {
+				// 外部キーで自動作成されたindexは書き出さない
+				continue
+			}
 			columnsString := strings.Join(ii.columns, ",")
 			if idxName == "PRIMARY" {
 				if _, exist := pKeysByTableNameMap[ii.tableName]; !exist {
@@ -41,7 +45,7 @@ func ExportToml(schemaToml, env, settingToml string, useEmbed bool) (err error)
 				if _, exist := fulltextIDXByTableNameMap[ii.tableName]; !exist {
 					fulltextIDXByTableNameMap[ii.tableName] = []string{}
 				}
-				fulltextIDXByTableNameMap[ii.tableName] = append(fulltextIDXByTableNameMap[ii.tableName], columnsString)
+				fulltextIDXByTableNameMap[ii.tableName] = append(fulltextIDXByTableNameMap[ii.tableName], exportFullTextIndex(columnsString, ii.fulltext))
 			} else {
 				if _, exist := indexesByTableNameMap[ii.tableName]; !exist {
 					indexesByTableNameMap[ii.tableName] = []string{}
@@ -57,9 +61,22 @@ func ExportToml(schemaToml, env, settingToml string, useEmbed bool) (err error)
 		columnLines := []string{}
 		for _, col := range ti.columns {
 			columnLine := fmt.Sprintf(`    {name = "%v", type = "%v"`, col.name, col.columnType)
-			if shouldAddColumnSize(col.columnType, col.size, col.unsigned) {
+			if len(col.values) > 0 {
+				values := []string{}
+				for _, value := range col.values {
+					values = append(values, fmt.Sprintf(`%q`, value))
+				}
+				columnLine += fmt.Sprintf(`, values = [%v]`, strings.Join(values, ", "))
+			} else if shouldAddColumnSize(col.columnType, col.size, col.unsigned) {
 				columnLine += fmt.Sprintf(`, size = "%v"`, col.size)
 			}
+			if col.precision != "" && !(col.columnType == "decimal" && col.precision == "10" && col.scale == "0") {
+				// decimal(10,0)はデフォルトなので書き出さない
+				columnLine += fmt.Sprintf(`, precision = "%v", scale = "%v"`, col.precision, col.scale)
+			}
+			if col.fsp != "" {
+				columnLine += fmt.Sprintf(`, fsp = "%v"`, col.fsp)
+			}
 			if col.unsigned {
 				columnLine += fmt.Sprintf(`, unsigned = true`)
 			}
@@ -72,12 +89,25 @@ func ExportToml(schemaToml, env, settingToml string, useEmbed bool) (err error)
 				columnLine += fmt.Sprintf(`, autoinc = true`)
 			}
 			if col.defaultValue.need {
-				columnLine += fmt.Sprintf(`, default = "%v"`, col.defaultValue.value)
+				columnLine += fmt.Sprintf(`, %v = %q`, exportDefaultKey(col), exportDefault(col.defaultValue))
+			}
+			if col.onUpdate != "" {
+				columnLine += fmt.Sprintf(`, on_update = "%v"`, col.onUpdate)
+			}
+			// テーブルのcharset, collationと同じものは書き出さない
+			if col.charset != "" && col.charset != ti.tableOption.charset {
+				columnLine += fmt.Sprintf(`, charset = "%v"`, col.charset)
+			}
+			if col.collation != "" && col.collation != ti.tableOption.collation {
+				columnLine += fmt.Sprintf(`, collation = "%v"`, col.collation)
+			}
+			if col.comment != "" {
+				columnLine += fmt.Sprintf(`, comment = %q`, col.comment)
 			}
 			columnLine += `},`
 			columnLines = append(columnLines, columnLine)
 		}
-		columnLines[len(columnLines) - 1] = strings.TrimRight(columnLines[len(columnLines) - 1], ",")
+		columnLines[len(columnLines)-1] = strings.TrimRight(columnLines[len(columnLines)-1], ",")
 		result = append(result, columnLines...)
 		result = append(result, `]`)
 		if pKeys, exist := pKeysByTableNameMap[ti.name]; exist {
@@ -102,18 +132,41 @@ func ExportToml(schemaToml, env, settingToml string, useEmbed bool) (err error)
 		if idxColumns, exist := fulltextIDXByTableNameMap[ti.name]; exist {
 			var idxesString string
 			for _, column := range idxColumns {
-				idxesString += fmt.Sprintf(`"%v",`, column)
+				idxesString += fmt.Sprintf(`%v,`, column)
 			}
 			idxesString = strings.TrimRight(idxesString, ",")
 			result = append(result, fmt.Sprintf(`fulltext_index = [%v]`, idxesString))
 		}
 		if ti.partition.partitionType != "" {
-			result = append(result, fmt.Sprintf(`partition = {type = "%v", key = "%v", basename = "%v", start = "%v", end = "%v", each = "%v"}`,
-				ti.partition.partitionType, ti.partition.keyColumn, ti.partition.baseName, ti.partition.startNum, ti.partition.endNum, ti.partition.eachRow))
+			result = append(result, fmt.Sprintf(`partition = {%v}`, strings.Join(exportPartitionFields(ti.partition), ", ")))
 		}
-		if ti.engine != "" {
+		if ti.engine != "" && ti.engine != fromDB.server.defaultEngine {
+			// デフォルトのengineは書き出さない
 			result = append(result, fmt.Sprintf(`engine = "%v"`, ti.engine))
 		}
+		if fields := exportEngineOptionFields(ti.engineOption); len(fields) > 0 {
+			result = append(result, fmt.Sprintf(`engine_options = {%v}`, strings.Join(fields, ", ")))
+		}
+		result = append(result, exportTableOptionLines(ti, fromDB.server)...)
+		if len(ti.foreignKeys) > 0 {
+			result = append(result, `foreign_keys = [`)
+			fkLines := []string{}
+			for _, fk := range ti.foreignKeys {
+				fkLine := fmt.Sprintf(`    {name = "%v", columns = "%v", ref_table = "%v", ref_columns = "%v"`,
+					fk.name, strings.Join(fk.columns, ","), fk.refTable, strings.Join(fk.refColumns, ","))
+				if fk.onDelete != "RESTRICT" {
+					fkLine += fmt.Sprintf(`, on_delete = "%v"`, fk.onDelete)
+				}
+				if fk.onUpdate != "RESTRICT" {
+					fkLine += fmt.Sprintf(`, on_update = "%v"`, fk.onUpdate)
+				}
+				fkLine += `},`
+				fkLines = append(fkLines, fkLine)
+			}
+			fkLines[len(fkLines)-1] = strings.TrimRight(fkLines[len(fkLines)-1], ",")
+			result = append(result, fkLines...)
+			result = append(result, `]`)
+		}
 		result[len(result)-1] += "\n"
 	}
 	fmt.Println(strings.Join(result, "\n"))
@@ -121,39 +174,127 @@ func ExportToml(schemaToml, env, settingToml string, useEmbed bool) (err error)
 	return
 }
 
+// 整数型のデフォルトの表示幅は書き出さない
 func shouldAddColumnSize(columnType, size string, unsigned bool) (result bool) {
-	switch columnType {
-	case "varchar":
-		result = true
-	case "int":
-		if unsigned && size != "10" {
-			result = true
-		} else if !unsigned && size != "11" {
-			result = true
-		}
-	case "bigint":
-		if size != "20" {
-			result = true
-		}
-	case "tinyint":
-		if unsigned && size != "3" {
-			result = true
-		} else if !unsigned && size != "4" {
-			result = true
+	return size != "" && size != defaultDisplayWidth(columnType, unsigned)
+}
+
+// partitionの指定をtomlのinline tableの項目にする
+func exportPartitionFields(pi partitionInfo) (result []string) {
+	result = append(result, fmt.Sprintf(`type = "%v"`, pi.partitionType), fmt.Sprintf(`key = "%v"`, pi.keyColumn))
+	switch {
+	case isHashPartition(pi):
+		result = append(result, fmt.Sprintf(`partitions = "%v"`, pi.partitions))
+	case pi.interval != "":
+		result = append(result, fmt.Sprintf(`basename = "%v"`, pi.baseName), fmt.Sprintf(`interval = "%v"`, pi.interval),
+			fmt.Sprintf(`start = "%v"`, pi.startNum), fmt.Sprintf(`end = "%v"`, pi.endNum))
+	case len(pi.values) > 0:
+		values := []string{}
+		for _, value := range pi.values {
+			values = append(values, fmt.Sprintf(`"%v"`, value))
 		}
-	case "smallint":
-		if unsigned && size != "5" {
-			result = true
-		} else if !unsigned && size != "6" {
-			result = true
+		result = append(result, fmt.Sprintf(`basename = "%v"`, pi.baseName), fmt.Sprintf(`start = "%v"`, pi.startNum),
+			fmt.Sprintf(`values = [%v]`, strings.Join(values, ", ")))
+	default:
+		result = append(result, fmt.Sprintf(`basename = "%v"`, pi.baseName), fmt.Sprintf(`start = "%v"`, pi.startNum),
+			fmt.Sprintf(`end = "%v"`, pi.endNum), fmt.Sprintf(`each = "%v"`, pi.eachRow))
+	}
+	if pi.subPartitionType != "" {
+		result = append(result, fmt.Sprintf(`subpartition_type = "%v"`, pi.subPartitionType),
+			fmt.Sprintf(`subpartition_key = "%v"`, pi.subPartitionKey), fmt.Sprintf(`subpartitions = "%v"`, pi.subPartitions))
+	}
+
+	return
+}
+
+// tokenizerがデフォルトのものだけ、parserの指定がない場合はカラムだけ書き出す
+func exportFullTextIndex(columnsString string, fulltext fulltextOption) string {
+	if (fulltext.tokenizer == defaultFullTextTokenizer || fulltext.tokenizer == "") && fulltext.normalizer == "" && len(fulltext.tokenFilters) == 0 && fulltext.parser == "" {
+		return fmt.Sprintf(`"%v"`, columnsString)
+	}
+	fields := []string{fmt.Sprintf(`columns = "%v"`, columnsString)}
+	if fulltext.parser != "" {
+		fields = append(fields, fmt.Sprintf(`parser = "%v"`, fulltext.parser))
+	}
+	if fulltext.tokenizer != "" {
+		fields = append(fields, fmt.Sprintf(`tokenizer = "%v"`, fulltext.tokenizer))
+	}
+	if fulltext.normalizer != "" {
+		fields = append(fields, fmt.Sprintf(`normalizer = "%v"`, fulltext.normalizer))
+	}
+	if len(fulltext.tokenFilters) > 0 {
+		tokenFilters := []string{}
+		for _, tokenFilter := range fulltext.tokenFilters {
+			tokenFilters = append(tokenFilters, fmt.Sprintf(`"%v"`, tokenFilter))
 		}
-	case "mediumint":
-		if unsigned && size != "8" {
-			result = true
-		} else if !unsigned && size != "9" {
-			result = true
+		fields = append(fields, fmt.Sprintf(`token_filters = [%v]`, strings.Join(tokenFilters, ", ")))
+	}
+
+	return fmt.Sprintf(`{%v}`, strings.Join(fields, ", "))
+}
+
+// Mroongaのテーブルのオプションをtomlのinline tableの項目にする
+func exportEngineOptionFields(option engineOption) (result []string) {
+	if option.wrappedEngine != "" {
+		result = append(result, fmt.Sprintf(`engine = "%v"`, option.wrappedEngine))
+	}
+	if option.defaultTokenizer != "" {
+		result = append(result, fmt.Sprintf(`default_tokenizer = "%v"`, option.defaultTokenizer))
+	}
+	if option.normalizer != "" {
+		result = append(result, fmt.Sprintf(`normalizer = "%v"`, option.normalizer))
+	}
+	if len(option.tokenFilters) > 0 {
+		tokenFilters := []string{}
+		for _, tokenFilter := range option.tokenFilters {
+			tokenFilters = append(tokenFilters, fmt.Sprintf(`"%v"`, tokenFilter))
 		}
+		result = append(result, fmt.Sprintf(`token_filters = [%v]`, strings.Join(tokenFilters, ", ")))
 	}
 
 	return
 }
+
+// デフォルトのものは書き出さない auto_incrementは常に変わるので書き出さない
+func exportTableOptionLines(ti tableInfo, server serverInfo) (result []string) {
+	option := ti.tableOption
+	if option.charset != "" && option.charset != server.defaultCharset {
+		result = append(result, fmt.Sprintf(`charset = "%v"`, option.charset))
+	}
+	if option.collation != "" && option.collation != server.defaultCollation {
+		result = append(result, fmt.Sprintf(`collation = "%v"`, option.collation))
+	}
+	if option.comment != "" && !isMroonga(ti.engine) {
+		// MroongaのテーブルのCOMMENTはengine_optionsで書き出す
+		result = append(result, fmt.Sprintf(`comment = %q`, option.comment))
+	}
+	if option.rowFormat != "" && option.rowFormat != "DYNAMIC" {
+		result = append(result, fmt.Sprintf(`row_format = "%v"`, option.rowFormat))
+	}
+	if option.keyBlockSize != "" && option.keyBlockSize != "0" {
+		result = append(result, fmt.Sprintf(`key_block_size = "%v"`, option.keyBlockSize))
+	}
+	if option.statsPersistent != "" && option.statsPersistent != "DEFAULT" {
+		result = append(result, fmt.Sprintf(`stats_persistent = "%v"`, option.statsPersistent))
+	}
+
+	return
+}
+
+// クォートしないものはdefault_exprで書き出す
+func exportDefaultKey(tc tableColumn) string {
+	if tc.defaultValue.kind != defaultLiteral || tc.columnType == "bit" {
+		return "default_expr"
+	}
+
+	return "default"
+}
+
+// 関数は小数秒の桁数を付けて書き出す 式はDBから読んだままの書き方で書き出す
+func exportDefault(dd defaultDetail) string {
+	if dd.kind == defaultFunction {
+		return buildCurrentTimestamp(dd.precision)
+	}
+
+	return dd.value
+}
@@ -0,0 +1,45 @@
+package proc
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+// DBから読んだデフォルト値をexportしてtomlとして読み直しても差分にならない
+func TestExportDefaultRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		columnType string
+		value      string
+		extra      string
+		server     serverInfo
+		wantKey    string
+		wantValue  string
+	}{
+		{"literal", "varchar", "it's", "", testMySQL, "default", "it's"},
+		{"function", "datetime", "CURRENT_TIMESTAMP(3)", "DEFAULT_GENERATED", testMySQL, "default_expr", "CURRENT_TIMESTAMP(3)"},
+		{"bit", "bit", "b'0'", "", testMySQL, "default_expr", "b'0'"},
+		{"mysql expression", "date", "cast(now() as date)", "DEFAULT_GENERATED", testMySQL, "default_expr", "cast(now() as date)"},
+		{"mysql quoted expression", "varchar", `concat(_utf8mb4\'a b\',uuid())`, "DEFAULT_GENERATED", testMySQL, "default_expr", "concat(_utf8mb4'a b',uuid())"},
+		{"mariadb expression", "date", "cast(current_timestamp() as date)", "", testMariaDB, "default_expr", "cast(current_timestamp() as date)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbTc := canonicalizeColumn(tableColumn{columnType: tt.columnType, defaultValue: parseDBDefault(sql.NullString{String: tt.value, Valid: true}, tt.extra, tt.server)}, tt.server)
+			key, value := exportDefaultKey(dbTc), exportDefault(dbTc.defaultValue)
+			if key != tt.wantKey || value != tt.wantValue {
+				t.Fatalf("got %v = %q, want %v = %q", key, value, tt.wantKey, tt.wantValue)
+			}
+			tc := tableColumn{columnType: tt.columnType}
+			if key == "default" {
+				tc.defaultValue = parseTomlDefault(value)
+			} else {
+				tc.defaultValue = parseTomlDefaultExpr(value)
+			}
+			if got := comparableDefault(canonicalizeColumn(tc, tt.server)); !reflect.DeepEqual(got, comparableDefault(dbTc)) {
+				t.Errorf("got %+v, want %+v", got.defaultValue, dbTc.defaultValue)
+			}
+		})
+	}
+}
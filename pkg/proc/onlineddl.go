@@ -0,0 +1,324 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ALTER TABLEの変更内容の種類 ALGORITHM, LOCKの判定に使う
+type ddlOp int
+
+const (
+	opOther        ddlOp = iota // CREATE TABLE, DROP TABLEなどALGORITHMを指定しないもの
+	opAppendColumn              // 末尾へのカラム追加
+	opAddColumn                 // 途中へのカラム追加
+	opAddAutoIncColumn
+	opDropColumn
+	opModifyDefault // デフォルト値のみの変更
+	opModifyNull    // NULL, NOT NULLのみの変更
+	opExtendVarchar // varcharの長さの拡張のみの変更
+	opAppendEnum    // enum, setの末尾への値の追加のみの変更
+	opModifyColumn  // それ以外のカラム変更 テーブル再構築になる
+	opMoveColumn    // カラムの並び替え
+	opAddIndex
+	opAddFullText
+	opDropIndex
+	opAddForeignKey
+	opDropForeignKey
+	opRenameColumn
+	opRenameIndex
+	opAddPrimaryKey
+	opDropPrimaryKey
+	opChangePrimaryKey // DROP PRIMARY KEY, ADD PRIMARY KEY
+	opChangeEngine
+	opTableOption // charset, ROW_FORMATなどのテーブルオプションの変更
+	opPartition   // ADD, DROP, REORGANIZE, COALESCE PARTITION
+	opRepartition // PARTITION BY, REMOVE PARTITIONING テーブル再構築になる
+)
+
+// 数字が小さいほどオンラインに近い
+type ddlAlgorithm int
+
+const (
+	algorithmInstant ddlAlgorithm = iota
+	algorithmInplace
+	algorithmCopy
+)
+
+var algorithmNames = map[ddlAlgorithm]string{
+	algorithmInstant: "INSTANT",
+	algorithmInplace: "INPLACE",
+	algorithmCopy:    "COPY",
+}
+
+// 数字が小さいほど並行して更新できる
+type ddlLock int
+
+const (
+	lockNone ddlLock = iota
+	lockShared
+	lockExclusive
+)
+
+var lockNames = map[ddlLock]string{
+	lockNone:      "NONE",
+	lockShared:    "SHARED",
+	lockExclusive: "EXCLUSIVE",
+}
+
+// tomlで指定されたALGORITHM, LOCK
+// algorithmはINSTANT, INPLACE, COPYのほかにAUTO(サーバーで使える一番良いものを選ぶ)が指定できる
+// 空文字は未指定でALTER TABLEにも付けない
+type onlineDDLOption struct {
+	algorithm string
+	lock      string
+}
+
+func parseOnlineDDLOption(optionMap map[string]interface{}, base onlineDDLOption) (result onlineDDLOption, err error) {
+	result = base
+
+	if optionIF, exist := optionMap["algorithm"]; exist {
+		result.algorithm = strings.ToUpper(optionIF.(string))
+		switch result.algorithm {
+		case "INSTANT", "INPLACE", "COPY", "AUTO", "DEFAULT":
+		default:
+			err = errors.New(fmt.Sprintf("algorithm %v is unknown. Please specify INSTANT, INPLACE, COPY, AUTO or DEFAULT", result.algorithm))
+			return
+		}
+	}
+	if optionIF, exist := optionMap["lock"]; exist {
+		result.lock = strings.ToUpper(optionIF.(string))
+		switch result.lock {
+		case "NONE", "SHARED", "EXCLUSIVE", "DEFAULT":
+		default:
+			err = errors.New(fmt.Sprintf("lock %v is unknown. Please specify NONE, SHARED, EXCLUSIVE or DEFAULT", result.lock))
+			return
+		}
+	}
+
+	return
+}
+
+// supportedOnlineDDL サーバーの種類、バージョンごとにその変更で使える一番良いALGORITHMと一番緩いLOCK
+// 公式ドキュメントのonline DDLの表を元にしているが行フォーマットやFULLTEXT indexの有無などの細かい条件は見ていない
+// online DDLはInnoDBのみで、MyISAMやMroongaなどはCOPYとして扱う
+func supportedOnlineDDL(op ddlOp, engine string, server serverInfo) (algorithm ddlAlgorithm, lock ddlLock) {
+	if engine != "" && engine != "InnoDB" {
+		return algorithmCopy, lockShared
+	}
+	instantAddColumn := (!server.isMariaDB() && server.atLeast(8, 0, 29)) || (server.isMariaDB() && server.atLeast(10, 4, 0))
+	instantAppendColumn := (!server.isMariaDB() && server.atLeast(8, 0, 12)) || (server.isMariaDB() && server.atLeast(10, 3, 2))
+	instantDefault := (!server.isMariaDB() && server.atLeast(8, 0, 0)) || (server.isMariaDB() && server.atLeast(10, 3, 2))
+
+	switch op {
+	case opAppendColumn:
+		if instantAppendColumn {
+			return algorithmInstant, lockNone
+		}
+		return algorithmInplace, lockNone
+	case opAddColumn:
+		if instantAddColumn {
+			return algorithmInstant, lockNone
+		}
+		return algorithmInplace, lockNone
+	case opAddAutoIncColumn:
+		return algorithmInplace, lockShared
+	case opDropColumn:
+		if instantAddColumn {
+			return algorithmInstant, lockNone
+		}
+		return algorithmInplace, lockNone
+	case opMoveColumn:
+		if server.isMariaDB() && server.atLeast(10, 4, 0) {
+			return algorithmInstant, lockNone
+		}
+		return algorithmInplace, lockNone
+	case opModifyDefault:
+		if instantDefault {
+			return algorithmInstant, lockNone
+		}
+		return algorithmInplace, lockNone
+	case opModifyNull:
+		return algorithmInplace, lockNone
+	case opAppendEnum:
+		if instantDefault {
+			return algorithmInstant, lockNone
+		}
+		return algorithmInplace, lockNone
+	case opExtendVarchar:
+		if server.isMariaDB() && server.atLeast(10, 4, 3) {
+			return algorithmInstant, lockNone
+		}
+		return algorithmInplace, lockNone
+	case opAddIndex, opDropIndex, opDropForeignKey:
+		return algorithmInplace, lockNone
+	case opAddFullText:
+		return algorithmInplace, lockShared
+	case opRenameColumn:
+		if (!server.isMariaDB() && server.atLeast(8, 0, 28)) || (server.isMariaDB() && server.atLeast(10, 5, 2)) {
+			return algorithmInstant, lockNone
+		}
+		return algorithmInplace, lockNone
+	case opRenameIndex:
+		if !server.isMariaDB() && server.atLeast(8, 0, 0) {
+			return algorithmInstant, lockNone
+		}
+		return algorithmInplace, lockNone
+	case opTableOption:
+		// ROW_FORMAT, KEY_BLOCK_SIZEはテーブル再構築になるがINPLACEでできる
+		return algorithmInplace, lockNone
+	case opAddPrimaryKey, opChangePrimaryKey:
+		return algorithmInplace, lockNone
+	case opDropPrimaryKey, opChangeEngine:
+		return algorithmCopy, lockShared
+	case opAddForeignKey:
+		// foreign_key_checksが有効な状態ではCOPYしか使えない
+		return algorithmCopy, lockShared
+	case opPartition:
+		// mariadbはパーティションの変更をINPLACEでできるか確認できていないのでCOPYにしておく
+		if !server.isMariaDB() {
+			return algorithmInplace, lockShared
+		}
+		return algorithmCopy, lockShared
+	case opRepartition:
+		return algorithmCopy, lockShared
+	}
+
+	return algorithmCopy, lockShared
+}
+
+// buildOnlineDDLClauses 1つのALTER TABLEにまとめる変更全てで使えるALGORITHM, LOCKを選んで句にする
+// 指定されたものが使えない場合は実行前にエラーにする
+func buildOnlineDDLClauses(tableName, engine string, changes []*ddlChange, requested onlineDDLOption, server serverInfo) (clauses []string, err error) {
+	if requested.algorithm == "" && requested.lock == "" {
+		return
+	}
+
+	bestAlgorithm := algorithmInstant
+	minLock := lockNone
+	for _, c := range changes {
+		for _, op := range c.ops() {
+			algorithm, lock := supportedOnlineDDL(op, engine, server)
+			if algorithm > bestAlgorithm {
+				bestAlgorithm = algorithm
+			}
+			if lock > minLock {
+				minLock = lock
+			}
+		}
+	}
+
+	algorithm := bestAlgorithm
+	switch requested.algorithm {
+	case "", "DEFAULT":
+		algorithm = -1
+	case "AUTO":
+	default:
+		for a, name := range algorithmNames {
+			if name == requested.algorithm {
+				algorithm = a
+			}
+		}
+		if algorithm < bestAlgorithm {
+			err = errors.New(fmt.Sprintf("table: %v ALGORITHM=%v is not supported on %v %v (best: %v): %v",
+				tableName, requested.algorithm, server, engine, algorithmNames[bestAlgorithm], joinClauses(changes)))
+			return
+		}
+	}
+	if algorithm >= 0 {
+		clauses = append(clauses, "ALGORITHM="+algorithmNames[algorithm])
+	}
+	if algorithm == algorithmCopy && minLock < lockShared {
+		minLock = lockShared
+	}
+
+	switch requested.lock {
+	case "", "DEFAULT":
+	default:
+		if algorithm == algorithmInstant && !server.isMariaDB() {
+			// mysqlではINSTANTのときLOCK=DEFAULTしか指定できない INSTANTはロックしないので付けない
+			return
+		}
+		var lock ddlLock
+		for l, name := range lockNames {
+			if name == requested.lock {
+				lock = l
+			}
+		}
+		if lock < minLock {
+			err = errors.New(fmt.Sprintf("table: %v LOCK=%v is not supported on %v %v (minimum: %v): %v",
+				tableName, requested.lock, server, engine, lockNames[minLock], joinClauses(changes)))
+			return
+		}
+		clauses = append(clauses, "LOCK="+requested.lock)
+	}
+
+	return
+}
+
+func joinClauses(changes []*ddlChange) string {
+	clauses := []string{}
+	for _, c := range changes {
+		clauses = append(clauses, c.clause)
+	}
+
+	return strings.Join(clauses, ", ")
+}
+
+// varcharは長さが255バイトを超えるかどうかで長さの保持に使うバイト数が変わり、またぐ場合は再構築になる
+// 文字コードまでは見ていないのでutf8mb4の1文字4バイトで判定する
+func isVarcharExtension(from, to tableColumn) bool {
+	if from.columnType != "varchar" || to.columnType != "varchar" {
+		return false
+	}
+	fromSize, err := strconv.Atoi(from.size)
+	if err != nil {
+		return false
+	}
+	toSize, err := strconv.Atoi(to.size)
+	if err != nil {
+		return false
+	}
+	if toSize < fromSize {
+		return false
+	}
+	from.size = to.size
+
+	return reflect.DeepEqual(from, to) && (fromSize*4 > 255) == (toSize*4 > 255)
+}
+
+// classifyModify カラム変更がどの種類の変更か
+func classifyModify(from, to tableColumn) ddlOp {
+	from, to = comparableDefault(from), comparableDefault(to)
+	if isVarcharExtension(from, to) {
+		return opExtendVarchar
+	}
+	if isEnumAppend(from, to) {
+		return opAppendEnum
+	}
+	onlyDefault := from
+	onlyDefault.defaultValue = to.defaultValue
+	if reflect.DeepEqual(onlyDefault, to) {
+		return opModifyDefault
+	}
+	onlyNull := from
+	onlyNull.null = to.null
+	if reflect.DeepEqual(onlyNull, to) {
+		return opModifyNull
+	}
+
+	return opModifyColumn
+}
+
+// まとめた変更も含めた変更の種類
+func (c *ddlChange) ops() []ddlOp {
+	result := []ddlOp{c.op}
+	for _, bundled := range c.bundled {
+		result = append(result, bundled.op)
+	}
+
+	return result
+}
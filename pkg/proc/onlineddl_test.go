@@ -0,0 +1,39 @@
+package proc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildOnlineDDLClauses(t *testing.T) {
+	tests := []struct {
+		name      string
+		engine    string
+		changes   []*ddlChange
+		requested onlineDDLOption
+		server    serverInfo
+		want      []string
+		wantErr   bool
+	}{
+		{"auto innodb", "InnoDB", []*ddlChange{{op: opAddIndex}}, onlineDDLOption{algorithm: "AUTO"}, testMySQL, []string{"ALGORITHM=INPLACE"}, false},
+		{"auto default engine", "", []*ddlChange{{op: opAppendColumn}}, onlineDDLOption{algorithm: "AUTO"}, testMySQL, []string{"ALGORITHM=INSTANT"}, false},
+		{"auto myisam", "MyISAM", []*ddlChange{{op: opAddIndex}}, onlineDDLOption{algorithm: "AUTO"}, testMySQL, []string{"ALGORITHM=COPY"}, false},
+		{"inplace myisam", "MyISAM", []*ddlChange{{op: opAddIndex}}, onlineDDLOption{algorithm: "INPLACE"}, testMySQL, nil, true},
+		{"lock none mroonga", "Mroonga", []*ddlChange{{op: opAddIndex}}, onlineDDLOption{lock: "NONE"}, testMariaDB, nil, true},
+		{"partition", "InnoDB", []*ddlChange{{op: opPartition}}, onlineDDLOption{algorithm: "AUTO", lock: "SHARED"}, testMySQL, []string{"ALGORITHM=INPLACE", "LOCK=SHARED"}, false},
+		{"partition lock none", "InnoDB", []*ddlChange{{op: opPartition}}, onlineDDLOption{lock: "NONE"}, testMySQL, nil, true},
+		{"repartition inplace", "InnoDB", []*ddlChange{{op: opRepartition}}, onlineDDLOption{algorithm: "INPLACE"}, testMySQL, nil, true},
+		{"not requested", "MyISAM", []*ddlChange{{op: opAddIndex}}, onlineDDLOption{}, testMySQL, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildOnlineDDLClauses("a", tt.engine, tt.changes, tt.requested, tt.server)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
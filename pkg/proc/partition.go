@@ -0,0 +1,618 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// partitionDefinition rangeはPARTITION name VALUES LESS THAN (value)、listはPARTITION name VALUES IN (value)
+// hash, keyはvalueなし
+type partitionDefinition struct {
+	name  string
+	value string // MAXVALUEの場合はMAXVALUE
+}
+
+const partitionMaxValue = "MAXVALUE"
+
+// 日付で区切る場合の間隔
+const (
+	partitionIntervalMonth = "month"
+	partitionIntervalDay   = "day"
+)
+
+// 日付で区切る場合のパーティション名の日付部分
+var partitionIntervalNameFormats = map[string]string{
+	partitionIntervalMonth: "200601",
+	partitionIntervalDay:   "20060102",
+}
+
+// e.g. TO_DAYS('2026-11-01')
+var partitionDateValueReg = regexp.MustCompile(`^([A-Z_]+)\('([0-9: -]+)'\)$`)
+
+// 対応しているパーティションの種類 INFORMATION_SCHEMA.PARTITIONS.PARTITION_METHODを小文字にしたもの
+var partitionTypes = map[string]struct{}{
+	"range":         {},
+	"range columns": {},
+	"list":          {},
+	"list columns":  {},
+	"hash":          {},
+	"linear hash":   {},
+	"key":           {},
+	"linear key":    {},
+}
+
+func isRangePartition(pi partitionInfo) bool {
+	return strings.HasPrefix(pi.partitionType, "range")
+}
+
+func isListPartition(pi partitionInfo) bool {
+	return strings.HasPrefix(pi.partitionType, "list")
+}
+
+// hash, keyはパーティションの数だけ指定する
+func isHashPartition(pi partitionInfo) bool {
+	return strings.HasSuffix(pi.partitionType, "hash") || strings.HasSuffix(pi.partitionType, "key")
+}
+
+// 大文字小文字, スペースの有無の違いはDBと比較するときに差分にしないように揃える
+func normalizePartitionType(partitionType string) string {
+	return strings.Join(strings.Fields(strings.ToLower(partitionType)), " ")
+}
+
+// keyはカラム名や式なのでバッククォートとスペースを取って小文字に揃える
+func normalizePartitionKey(key string) string {
+	key = strings.ReplaceAll(key, "`", "")
+
+	return strings.ToLower(strings.Join(strings.Fields(key), ""))
+}
+
+// クォートの外のスペースを取って大文字にする。RANGE COLUMNSのMAXVALUE,MAXVALUEはMAXVALUEにする
+// 日付を関数に渡しているものは日付の書き方を揃える
+func normalizePartitionValue(value string) string {
+	var normalized strings.Builder
+	var quote rune
+	for _, r := range strings.TrimSpace(value) {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ' ' || r == '\t' || r == '\n':
+			continue
+		default:
+			r = []rune(strings.ToUpper(string(r)))[0]
+		}
+		normalized.WriteRune(r)
+	}
+	value = normalized.String()
+	if matches := partitionDateValueReg.FindStringSubmatch(value); matches != nil {
+		if date, err := parsePartitionDate(matches[2]); err == nil {
+			return buildPartitionDateValue(strings.ToLower(matches[1]), date)
+		}
+	}
+	for _, part := range strings.Split(value, ",") {
+		if part != partitionMaxValue {
+			return value
+		}
+	}
+
+	return partitionMaxValue
+}
+
+// パーティションキーが日付を数値にする関数の場合はその関数名
+func partitionKeyFunction(pi partitionInfo) string {
+	for _, function := range []string{"to_days", "to_seconds", "unix_timestamp"} {
+		if strings.HasPrefix(pi.keyColumn, function+"(") {
+			return function
+		}
+	}
+
+	return ""
+}
+
+func parsePartitionDate(value string) (result time.Time, err error) {
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02", "2006-01"} {
+		result, err = time.Parse(layout, value)
+		if err == nil {
+			return
+		}
+	}
+
+	return
+}
+
+// 日付の区切りの値 関数がない場合(RANGE COLUMNS)は日付そのもの
+func buildPartitionDateValue(function string, date time.Time) string {
+	layout := "2006-01-02"
+	if date.Hour() != 0 || date.Minute() != 0 || date.Second() != 0 {
+		layout = "2006-01-02 15:04:05"
+	}
+	literal := fmt.Sprintf("'%v'", date.Format(layout))
+	if function == "" {
+		return literal
+	}
+
+	return fmt.Sprintf("%v(%v)", strings.ToUpper(function), literal)
+}
+
+// DBのPARTITION_DESCRIPTIONは関数を評価した後の数値なので、tomlと比較できるように日付に戻す
+// UNIX_TIMESTAMPはDBのタイムゾーンで評価されるのでそのオフセットで戻す
+func partitionValueFromDB(pi partitionInfo, value string, location *time.Location) string {
+	value = normalizePartitionValue(value)
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return value
+	}
+	var date time.Time
+	switch function := partitionKeyFunction(pi); function {
+	case "to_days":
+		// TO_DAYS('0001-01-01')が366
+		date = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(number-366))
+	case "to_seconds":
+		// time.Durationだと桁が足りないので日と秒に分ける
+		date = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, int(number/86400-366)).Add(time.Duration(number%86400) * time.Second)
+	case "unix_timestamp":
+		date = time.Unix(number, 0).In(location)
+	default:
+		return value
+	}
+
+	return buildPartitionDateValue(partitionKeyFunction(pi), date)
+}
+
+// 日付で区切る場合の次の区切り
+func nextPartitionDate(interval string, date time.Time) time.Time {
+	if interval == partitionIntervalDay {
+		return date.AddDate(0, 0, 1)
+	}
+
+	return date.AddDate(0, 1, 0)
+}
+
+func previousPartitionDate(interval string, date time.Time) time.Time {
+	if interval == partitionIntervalDay {
+		return date.AddDate(0, 0, -1)
+	}
+
+	return date.AddDate(0, -1, 0)
+}
+
+// 日付で区切る場合の開始日 月ごとの場合は月初にする
+func truncatePartitionDate(interval string, date time.Time) time.Time {
+	if interval == partitionIntervalMonth {
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// partitionDefinitions partitionInfoから実際に作るパーティションの一覧
+func partitionDefinitions(pi partitionInfo) (result []partitionDefinition) {
+	if isHashPartition(pi) {
+		// 名前はDBが付けるp0からの連番
+		partitions, _ := strconv.Atoi(pi.partitions)
+		for i := 0; i < partitions; i++ {
+			result = append(result, partitionDefinition{name: fmt.Sprintf("p%v", i)})
+		}
+		return
+	}
+	if pi.interval != "" {
+		// [[name]][[日付]]はその日付の期間が入るので、区切りは次の期間の開始日
+		start, _ := parsePartitionDate(pi.startNum)
+		end, _ := parsePartitionDate(pi.endNum)
+		end = truncatePartitionDate(pi.interval, end)
+		for date := truncatePartitionDate(pi.interval, start); !date.After(end); date = nextPartitionDate(pi.interval, date) {
+			result = append(result, partitionDefinition{
+				name:  pi.baseName + date.Format(partitionIntervalNameFormats[pi.interval]),
+				value: buildPartitionDateValue(partitionKeyFunction(pi), nextPartitionDate(pi.interval, date)),
+			})
+		}
+		result = append(result, partitionDefinition{name: pi.baseName + "max", value: partitionMaxValue})
+		return
+	}
+	startIDX, _ := strconv.Atoi(pi.startNum)
+	if len(pi.values) > 0 {
+		for i, value := range pi.values {
+			result = append(result, partitionDefinition{name: fmt.Sprintf("%v%v", pi.baseName, startIDX+i), value: value})
+		}
+		return
+	}
+	endIDX, _ := strconv.Atoi(pi.endNum)
+	eachRows, _ := strconv.Atoi(pi.eachRow)
+	for i := startIDX; i <= endIDX; i++ {
+		var value string
+		if i == endIDX {
+			value = partitionMaxValue
+		} else {
+			value = strconv.Itoa(i * eachRows)
+		}
+		result = append(result, partitionDefinition{name: fmt.Sprintf("%v%v", pi.baseName, i), value: value})
+	}
+
+	return
+}
+
+// partitionFromDefinitions DBから読んだパーティションの一覧をtomlの指定に戻す
+// rangeで[[name]][[startNum]]から連番でeachRowごとに区切られていて最後がMAXVALUEならstart, end, each、そうでなければvaluesにする
+func partitionFromDefinitions(pi partitionInfo, definitions []partitionDefinition) partitionInfo {
+	pi.definitions = definitions
+	if isHashPartition(pi) {
+		pi.partitions = strconv.Itoa(len(definitions))
+		return pi
+	}
+	pi.baseName = strings.TrimRightFunc(definitions[0].name, func(r rune) bool { return r >= '0' && r <= '9' })
+	if intervalPi, ok := partitionIntervalFromDefinitions(pi, definitions); ok {
+		return intervalPi
+	}
+	pi.startNum = strings.TrimPrefix(definitions[0].name, pi.baseName)
+	if pi.startNum == "" {
+		pi.startNum = "1"
+	}
+	startIDX, _ := strconv.Atoi(pi.startNum)
+	pi.endNum = strconv.Itoa(startIDX + len(definitions) - 1)
+	pi.values = nil
+	pi.eachRow = ""
+	if pi.partitionType == "range" && len(definitions) > 1 {
+		first, _ := strconv.Atoi(definitions[0].value)
+		if startIDX != 0 && first%startIDX == 0 {
+			pi.eachRow = strconv.Itoa(first / startIDX)
+		}
+	}
+	if pi.eachRow != "" && reflect.DeepEqual(partitionDefinitions(pi), definitions) {
+		return pi
+	}
+	pi.eachRow = ""
+	pi.endNum = ""
+	for _, pd := range definitions {
+		pi.values = append(pi.values, pd.value)
+	}
+	if !reflect.DeepEqual(partitionDefinitions(pi), definitions) {
+		// basenameと連番になっていないパーティション名は引き継げないので区切りだけ合わせる
+		pi.definitions = partitionDefinitions(pi)
+	}
+
+	return pi
+}
+
+// [[name]][[日付]]で日付ごとに区切られていて最後が[[name]]maxのMAXVALUEなら日付で区切ったパーティション
+func partitionIntervalFromDefinitions(pi partitionInfo, definitions []partitionDefinition) (result partitionInfo, ok bool) {
+	if !isRangePartition(pi) || len(definitions) < 2 || (partitionKeyFunction(pi) == "" && pi.partitionType != "range columns") {
+		return
+	}
+	for interval, nameFormat := range partitionIntervalNameFormats {
+		start, err := time.Parse(nameFormat, strings.TrimPrefix(definitions[0].name, pi.baseName))
+		if err != nil {
+			continue
+		}
+		end, err := time.Parse(nameFormat, strings.TrimPrefix(definitions[len(definitions)-2].name, pi.baseName))
+		if err != nil {
+			continue
+		}
+		result = pi
+		result.interval = interval
+		result.startNum = start.Format("2006-01-02")
+		result.endNum = end.Format("2006-01-02")
+		result.definitions = definitions
+		if reflect.DeepEqual(partitionDefinitions(result), definitions) {
+			ok = true
+			return
+		}
+	}
+
+	return
+}
+
+func buildPartitionDefinitions(pi partitionInfo, definitions []partitionDefinition) string {
+	result := []string{}
+	for _, pd := range definitions {
+		if isListPartition(pi) {
+			result = append(result, fmt.Sprintf(" PARTITION %v VALUES IN (%v)", pd.name, pd.value))
+			continue
+		}
+		value := pd.value
+		if value != partitionMaxValue {
+			value = fmt.Sprintf("(%v)", value)
+		} else if pi.partitionType == "range columns" {
+			// RANGE COLUMNSはカラムの数だけMAXVALUEが必要
+			maxValues := []string{}
+			for range strings.Split(pi.keyColumn, ",") {
+				maxValues = append(maxValues, partitionMaxValue)
+			}
+			value = fmt.Sprintf("(%v)", strings.Join(maxValues, ","))
+		}
+		result = append(result, fmt.Sprintf(" PARTITION %v VALUES LESS THAN %v", pd.name, value))
+	}
+
+	return fmt.Sprintf("(%v)", strings.Join(result, ","))
+}
+
+// CREATE TABLEとALTER TABLEで共通のPARTITION BY
+func buildPartitionByClause(pi partitionInfo) string {
+	if isHashPartition(pi) {
+		return fmt.Sprintf("PARTITION BY %v (%v) PARTITIONS %v", pi.partitionType, pi.keyColumn, pi.partitions)
+	}
+
+	var subPartition string
+	if pi.subPartitionType != "" {
+		subPartition = fmt.Sprintf(" SUBPARTITION BY %v (%v) SUBPARTITIONS %v", pi.subPartitionType, pi.subPartitionKey, pi.subPartitions)
+	}
+
+	return fmt.Sprintf("PARTITION BY %v (%v)%v %v", pi.partitionType, pi.keyColumn, subPartition, buildPartitionDefinitions(pi, pi.definitions))
+}
+
+// パーティションキー、サブパーティションキーに使っているカラム
+// TO_DAYS(created_at)のような式の場合は括弧の中のカラム
+func partitionKeyColumns(pi partitionInfo) (result []string) {
+	for _, key := range []string{pi.keyColumn, pi.subPartitionKey} {
+		if key == "" {
+			continue
+		}
+		if start, end := strings.Index(key, "("), strings.LastIndex(key, ")"); start != -1 && end > start {
+			key = key[start+1 : end]
+		}
+		result = append(result, strings.Split(key, ",")...)
+	}
+
+	return
+}
+
+// start, end, eachとvaluesのどちらで指定していても実際に作られるパーティションが同じなら同じとみなす
+// hash, keyのパーティション名はDBが付けるので数だけ比較する
+func samePartition(a, b partitionInfo) bool {
+	if !sameSubPartition(a, b) || a.partitionType != b.partitionType || a.keyColumn != b.keyColumn {
+		return false
+	}
+	if isHashPartition(a) {
+		return len(a.definitions) == len(b.definitions)
+	}
+
+	return reflect.DeepEqual(a.definitions, b.definitions)
+}
+
+// サブパーティションは変更する場合はPARTITION BYで作り直す
+func sameSubPartition(a, b partitionInfo) bool {
+	return a.subPartitionType == b.subPartitionType && a.subPartitionKey == b.subPartitionKey && a.subPartitions == b.subPartitions
+}
+
+// 既存テーブルのパーティションの差分
+// ADD PARTITION, REORGANIZE PARTITION, COALESCE PARTITIONで済む場合はそちらを使い、それ以外はPARTITION BYで作り直す
+func procPartitionDiff(fromToml, fromDB schema, result *Queries) {
+	for _, ti := range fromToml.tables {
+		dbTi, exist := fromDB.tablesMap[ti.name]
+		if !exist || samePartition(ti.partition, dbTi.partition) {
+			continue
+		}
+		pi := ti.partition
+		dbPi := dbTi.partition
+		pk := fromToml.indexInfosMap[ti.name]["PRIMARY"]
+		dbPK := fromDB.indexInfosMap[ti.name]["PRIMARY"]
+		if pi.partitionType == "" {
+			result.add(newRemovePartitioningChange(ti.name, dbPi, dbPK))
+			continue
+		}
+		if dbPi.partitionType == "" {
+			result.add(newPartitionByChange(ti.name, pi, dbPi))
+			continue
+		}
+		if !sameSubPartition(pi, dbPi) || pi.partitionType != dbPi.partitionType || pi.keyColumn != dbPi.keyColumn {
+			if !reflect.DeepEqual(pk, dbPK) {
+				// primaryにはパーティションキーが含まれている必要があるので、primaryの付け替えの前に一度パーティションを外す
+				result.add(newRemovePartitioningChange(ti.name, dbPi, dbPK))
+				result.add(newPartitionByChange(ti.name, pi, partitionInfo{}))
+				continue
+			}
+			result.add(newPartitionByChange(ti.name, pi, dbPi))
+			continue
+		}
+
+		if isRollingPartition(pi) && sameRollingLayout(pi, dbPi) {
+			// gomig partitionsで追加、削除しているパーティションは作り直さない
+			continue
+		}
+
+		definitions := pi.definitions
+		dbDefinitions := dbPi.definitions
+		if isHashPartition(pi) {
+			if len(definitions) > len(dbDefinitions) {
+				result.add(newPartitionChange(ti.name, fmt.Sprintf("ADD PARTITION PARTITIONS %v", len(definitions)-len(dbDefinitions))))
+			} else {
+				result.add(newPartitionChange(ti.name, fmt.Sprintf("COALESCE PARTITION %v", len(dbDefinitions)-len(definitions))))
+			}
+			continue
+		}
+		common := 0
+		for common < len(definitions) && common < len(dbDefinitions) && definitions[common] == dbDefinitions[common] {
+			common++
+		}
+		// rangeは範囲の上限が同じ場合、listは値が入るパーティションがなくなったらエラーになるので作り直すパーティションがある場合
+		reorganizable := common < len(definitions) && common < len(dbDefinitions) &&
+			(isListPartition(pi) || definitions[len(definitions)-1].value == dbDefinitions[len(dbDefinitions)-1].value)
+		switch {
+		case common == len(definitions) && common == len(dbDefinitions):
+			// 実際に作られるパーティションは同じ
+		case common == len(dbDefinitions):
+			// MAXVALUEのパーティションがない場合やlistは後ろに追加するだけ
+			result.add(newPartitionChange(ti.name, fmt.Sprintf("ADD PARTITION %v", buildPartitionDefinitions(pi, definitions[common:]))))
+		case reorganizable:
+			// 変わる部分のパーティションだけ作り直す
+			names := []string{}
+			for _, pd := range dbDefinitions[common:] {
+				names = append(names, pd.name)
+			}
+			result.add(newPartitionChange(ti.name, fmt.Sprintf("REORGANIZE PARTITION %v INTO %v", strings.Join(names, ","), buildPartitionDefinitions(pi, definitions[common:]))))
+		default:
+			result.add(newPartitionByChange(ti.name, pi, dbPi))
+		}
+	}
+}
+
+// パーティションの変更は他の変更と同じALTER TABLEにはできないので常に1文で実行する
+func newPartitionChange(tableName, clause string) *ddlChange {
+	result := &ddlChange{phase: phasePartition, op: opPartition, tableName: tableName, clause: clause, standalone: true}
+	result.needs = append(result.needs, tableKey(tableName))
+
+	return result
+}
+
+func newPartitionByChange(tableName string, pi, dbPi partitionInfo) *ddlChange {
+	result := newPartitionChange(tableName, buildPartitionByClause(pi))
+	result.op = opRepartition
+	// パーティションキーはprimaryに含まれている必要があるのでprimaryの付け替え後
+	result.needs = append(result.needs, columnKeys(tableName, partitionKeyColumns(pi))...)
+	result.needs = append(result.needs, indexKey(tableName, "PRIMARY"))
+	if dbPi.partitionType != "" {
+		for _, column := range partitionKeyColumns(dbPi) {
+			if !containsName(partitionKeyColumns(pi), column) {
+				result.releases = append(result.releases, columnKey(tableName, column))
+			}
+		}
+	}
+
+	return result
+}
+
+func newRemovePartitioningChange(tableName string, dbPi partitionInfo, dbPK *indexInfo) *ddlChange {
+	result := newPartitionChange(tableName, "REMOVE PARTITIONING")
+	result.phase = phaseRemovePartitioning
+	result.op = opRepartition
+	// パーティションキーのカラムの削除、primaryの付け替えはパーティションを外した後
+	result.releases = append(result.releases, columnKeys(tableName, partitionKeyColumns(dbPi))...)
+	if dbPK != nil {
+		result.releases = append(result.releases, keyKey(tableName, dbPK.columns))
+	}
+
+	return result
+}
+
+// gomig partitionsで追加、削除するパーティションか
+func isRollingPartition(pi partitionInfo) bool {
+	return pi.future != "" || pi.retention != ""
+}
+
+// 区切り方が同じならパーティションの範囲が違ってもgomig partitionsで追加、削除したものとみなす
+func sameRollingLayout(pi, dbPi partitionInfo) bool {
+	if !sameSubPartition(pi, dbPi) || pi.partitionType != dbPi.partitionType || pi.keyColumn != dbPi.keyColumn || pi.baseName != dbPi.baseName {
+		return false
+	}
+	if pi.interval != "" {
+		return pi.interval == dbPi.interval
+	}
+
+	return pi.eachRow != "" && pi.eachRow == dbPi.eachRow
+}
+
+// REORGANIZE PARTITION後のMAXVALUE以外のパーティション
+// 長期間実行していなかった場合などREORGANIZEで作成したパーティションや元のMAXVALUEのパーティションも
+// retentionより古くなることがあるので、削除するパーティションはこの並びから選ぶ
+func rollingLayout(dbPi partitionInfo, created []partitionDefinition) []partitionDefinition {
+	result := append([]partitionDefinition{}, dbPi.definitions[:len(dbPi.definitions)-1]...)
+
+	return append(result, created[:len(created)-1]...)
+}
+
+// procPartitionRolling 日付やeachで区切ったパーティションの未来のパーティションをfutureの数まで作成し、retentionより古いパーティションを削除する
+// 未来のパーティションはMAXVALUEのパーティションをREORGANIZEして作成する
+// eachで区切ったパーティションはkeyMaxes(パーティションキーの最大値)が入るパーティションを現在のパーティションとする
+func procPartitionRolling(fromToml, fromDB schema, now time.Time, keyMaxes map[string]int64) (result []string, err error) {
+	for _, ti := range fromToml.tables {
+		pi := ti.partition
+		if !isRollingPartition(pi) {
+			continue
+		}
+		dbTi, exist := fromDB.tablesMap[ti.name]
+		if !exist || !sameRollingLayout(pi, dbTi.partition) {
+			err = errors.New(fmt.Sprintf("table: %v partition in DB does not match toml. run migration first", ti.name))
+			return
+		}
+		dbPi := dbTi.partition
+		future, _ := strconv.Atoi(pi.future)
+
+		var created, expired []partitionDefinition
+		var maxName string
+		if pi.interval != "" {
+			current := truncatePartitionDate(pi.interval, now)
+			last, _ := parsePartitionDate(dbPi.endNum)
+			target := current
+			for i := 0; i < future; i++ {
+				target = nextPartitionDate(pi.interval, target)
+			}
+			for date := nextPartitionDate(pi.interval, last); !date.After(target); date = nextPartitionDate(pi.interval, date) {
+				created = append(created, partitionDefinition{
+					name:  pi.baseName + date.Format(partitionIntervalNameFormats[pi.interval]),
+					value: buildPartitionDateValue(partitionKeyFunction(pi), nextPartitionDate(pi.interval, date)),
+				})
+			}
+			maxName = pi.baseName + "max"
+			created = append(created, partitionDefinition{name: maxName, value: partitionMaxValue})
+			if pi.retention != "" {
+				retention, _ := strconv.Atoi(pi.retention)
+				cutoff := current
+				for i := 0; i < retention; i++ {
+					cutoff = previousPartitionDate(pi.interval, cutoff)
+				}
+				for _, pd := range rollingLayout(dbPi, created) {
+					date, _ := time.Parse(partitionIntervalNameFormats[pi.interval], strings.TrimPrefix(pd.name, pi.baseName))
+					if date.Before(cutoff) {
+						expired = append(expired, pd)
+					}
+				}
+			}
+		} else {
+			// base[[i]]にはeachRow * (i - 1)以上eachRow * i未満が入る
+			eachRows, _ := strconv.Atoi(dbPi.eachRow)
+			startIDX, _ := strconv.Atoi(dbPi.startNum)
+			endIDX, _ := strconv.Atoi(dbPi.endNum)
+			current := startIDX
+			if keyMax, exist := keyMaxes[ti.name]; exist {
+				current = int(keyMax)/eachRows + 1
+			}
+			target := current + future
+			for i := endIDX; i <= target; i++ {
+				created = append(created, partitionDefinition{name: fmt.Sprintf("%v%v", pi.baseName, i), value: strconv.Itoa(i * eachRows)})
+			}
+			maxName = fmt.Sprintf("%v%v", pi.baseName, endIDX)
+			if target >= endIDX {
+				// MAXVALUEのパーティションは最後の番号にする
+				endIDX = target + 1
+			}
+			created = append(created, partitionDefinition{name: fmt.Sprintf("%v%v", pi.baseName, endIDX), value: partitionMaxValue})
+			if pi.retention != "" {
+				retention, _ := strconv.Atoi(pi.retention)
+				layout := rollingLayout(dbPi, created)
+				for i := startIDX; i < current-retention && i-startIDX < len(layout); i++ {
+					expired = append(expired, layout[i-startIDX])
+				}
+			}
+		}
+
+		changes := []*ddlChange{}
+		if len(created) > 1 {
+			changes = append(changes, newPartitionChange(ti.name, fmt.Sprintf("REORGANIZE PARTITION %v INTO %v", maxName, buildPartitionDefinitions(pi, created))))
+		}
+		if len(expired) > 0 {
+			names := []string{}
+			for _, pd := range expired {
+				names = append(names, pd.name)
+			}
+			changes = append(changes, newPartitionChange(ti.name, fmt.Sprintf("DROP PARTITION %v", strings.Join(names, ","))))
+		}
+		for _, c := range changes {
+			// ALGORITHM, LOCKの指定はマイグレーションと同じく付ける
+			var onlineClauses []string
+			onlineClauses, err = buildOnlineDDLClauses(ti.name, tableEngine(ti, fromDB.server), []*ddlChange{c}, ti.onlineDDL, fromDB.server)
+			if err != nil {
+				return
+			}
+			result = append(result, buildAlterStatement(ti.name, []*ddlChange{c}, onlineClauses))
+		}
+	}
+
+	return
+}
@@ -0,0 +1,237 @@
+package proc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProcPartitionDiff(t *testing.T) {
+	const columns = `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "created_at", type = "datetime"}]
+primary = ["id", "created_at"]
+`
+	tests := []struct {
+		name        string
+		partition   string
+		dbPartition string
+		want        []string
+	}{
+		{
+			name:        "same",
+			partition:   `partition = {type = "range", key = "id", basename = "p", end = "3"}`,
+			dbPartition: `partition = {type = "range", key = "id", basename = "p", end = "3"}`,
+		},
+		{
+			name:      "add partitioning",
+			partition: `partition = {type = "range", key = "id", basename = "p", end = "2"}`,
+			want:      []string{"ALTER TABLE a PARTITION BY range (id) ( PARTITION p1 VALUES LESS THAN (10000), PARTITION p2 VALUES LESS THAN MAXVALUE)"},
+		},
+		{
+			name:        "remove partitioning",
+			dbPartition: `partition = {type = "range", key = "id", basename = "p", end = "2"}`,
+			want:        []string{"ALTER TABLE a REMOVE PARTITIONING"},
+		},
+		{
+			name:        "extend range",
+			partition:   `partition = {type = "range", key = "id", basename = "p", end = "4"}`,
+			dbPartition: `partition = {type = "range", key = "id", basename = "p", end = "2"}`,
+			want:        []string{"ALTER TABLE a REORGANIZE PARTITION p2 INTO ( PARTITION p2 VALUES LESS THAN (20000), PARTITION p3 VALUES LESS THAN (30000), PARTITION p4 VALUES LESS THAN MAXVALUE)"},
+		},
+		{
+			name:        "start and each",
+			partition:   `partition = {type = "range", key = "id", basename = "p", start = "3", end = "5", each = "100"}`,
+			dbPartition: `partition = {type = "range", key = "id", basename = "p", start = "3", end = "4", each = "100"}`,
+			want:        []string{"ALTER TABLE a REORGANIZE PARTITION p4 INTO ( PARTITION p4 VALUES LESS THAN (400), PARTITION p5 VALUES LESS THAN MAXVALUE)"},
+		},
+		{
+			name:        "add hash partitions",
+			partition:   `partition = {type = "hash", key = "id", partitions = "6"}`,
+			dbPartition: `partition = {type = "hash", key = "id", partitions = "4"}`,
+			want:        []string{"ALTER TABLE a ADD PARTITION PARTITIONS 2"},
+		},
+		{
+			name:        "coalesce hash partitions",
+			partition:   `partition = {type = "linear hash", key = "id", partitions = "2"}`,
+			dbPartition: `partition = {type = "linear hash", key = "id", partitions = "4"}`,
+			want:        []string{"ALTER TABLE a COALESCE PARTITION 2"},
+		},
+		{
+			name:        "add list partition",
+			partition:   `partition = {type = "list", key = "id", basename = "p", values = ["1,2", "3", "4,5"]}`,
+			dbPartition: `partition = {type = "list", key = "id", basename = "p", values = ["1,2", "3"]}`,
+			want:        []string{"ALTER TABLE a ADD PARTITION ( PARTITION p3 VALUES IN (4,5))"},
+		},
+		{
+			name:        "change partition type",
+			partition:   `partition = {type = "key", key = "id", partitions = "4"}`,
+			dbPartition: `partition = {type = "hash", key = "id", partitions = "4"}`,
+			want:        []string{"ALTER TABLE a PARTITION BY key (id) PARTITIONS 4"},
+		},
+		{
+			name:        "range columns values",
+			partition:   `partition = {type = "range columns", key = "id", basename = "p", values = ["10", "20", "MAXVALUE"]}`,
+			dbPartition: `partition = {type = "range columns", key = "id", basename = "p", values = ["10", "MAXVALUE"]}`,
+			want:        []string{"ALTER TABLE a REORGANIZE PARTITION p2 INTO ( PARTITION p2 VALUES LESS THAN (20), PARTITION p3 VALUES LESS THAN (MAXVALUE))"},
+		},
+		{
+			name:        "extend interval",
+			partition:   `partition = {type = "range", key = "TO_DAYS(created_at)", basename = "p", interval = "month", start = "2024-01-01", end = "2024-03-01"}`,
+			dbPartition: `partition = {type = "range", key = "to_days(created_at)", basename = "p", interval = "month", start = "2024-01-01", end = "2024-02-01"}`,
+			want:        []string{"ALTER TABLE a REORGANIZE PARTITION pmax INTO ( PARTITION p202403 VALUES LESS THAN (TO_DAYS('2024-04-01')), PARTITION pmax VALUES LESS THAN MAXVALUE)"},
+		},
+		{
+			name:        "change interval",
+			partition:   `partition = {type = "range", key = "TO_DAYS(created_at)", basename = "p", interval = "day", start = "2024-01-01", end = "2024-01-02"}`,
+			dbPartition: `partition = {type = "range", key = "TO_DAYS(created_at)", basename = "p", interval = "month", start = "2024-01-01", end = "2024-01-01"}`,
+			want:        []string{"ALTER TABLE a REORGANIZE PARTITION p202401,pmax INTO ( PARTITION p20240101 VALUES LESS THAN (TO_DAYS('2024-01-02')), PARTITION p20240102 VALUES LESS THAN (TO_DAYS('2024-01-03')), PARTITION pmax VALUES LESS THAN MAXVALUE)"},
+		},
+		{
+			name:        "add subpartitions",
+			partition:   `partition = {type = "range", key = "id", basename = "p", end = "2", subpartition_type = "hash", subpartition_key = "TO_DAYS(created_at)", subpartitions = "2"}`,
+			dbPartition: `partition = {type = "range", key = "id", basename = "p", end = "2"}`,
+			want:        []string{"ALTER TABLE a PARTITION BY range (id) SUBPARTITION BY hash (to_days(created_at)) SUBPARTITIONS 2 ( PARTITION p1 VALUES LESS THAN (10000), PARTITION p2 VALUES LESS THAN MAXVALUE)"},
+		},
+		{
+			name:        "same subpartitions",
+			partition:   `partition = {type = "range", key = "id", basename = "p", end = "2", subpartition_type = "hash", subpartition_key = "TO_DAYS(created_at)", subpartitions = "2"}`,
+			dbPartition: `partition = {type = "range", key = "id", basename = "p", end = "2", subpartition_type = "HASH", subpartition_key = "to_days(created_at)", subpartitions = "2"}`,
+		},
+		{
+			name:        "extend range with subpartitions",
+			partition:   `partition = {type = "range", key = "id", basename = "p", end = "3", subpartition_type = "key", subpartition_key = "id", subpartitions = "2"}`,
+			dbPartition: `partition = {type = "range", key = "id", basename = "p", end = "2", subpartition_type = "key", subpartition_key = "id", subpartitions = "2"}`,
+			want:        []string{"ALTER TABLE a REORGANIZE PARTITION p2 INTO ( PARTITION p2 VALUES LESS THAN (20000), PARTITION p3 VALUES LESS THAN MAXVALUE)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustPlan(t, columns+tt.partition, columns+tt.dbPartition, testMySQL); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartitionFromDefinitions(t *testing.T) {
+	tests := []struct {
+		name        string
+		pi          partitionInfo
+		definitions []partitionDefinition
+		want        partitionInfo
+	}{
+		{
+			name:        "hash",
+			pi:          partitionInfo{partitionType: "hash", keyColumn: "id"},
+			definitions: []partitionDefinition{{name: "p0"}, {name: "p1"}, {name: "p2"}},
+			want:        partitionInfo{partitionType: "hash", keyColumn: "id", partitions: "3", definitions: []partitionDefinition{{name: "p0"}, {name: "p1"}, {name: "p2"}}},
+		},
+		{
+			name:        "range each",
+			pi:          partitionInfo{partitionType: "range", keyColumn: "id"},
+			definitions: []partitionDefinition{{name: "p1", value: "100"}, {name: "p2", value: "200"}, {name: "p3", value: partitionMaxValue}},
+			want: partitionInfo{partitionType: "range", keyColumn: "id", baseName: "p", startNum: "1", endNum: "3", eachRow: "100",
+				definitions: []partitionDefinition{{name: "p1", value: "100"}, {name: "p2", value: "200"}, {name: "p3", value: partitionMaxValue}}},
+		},
+		{
+			name:        "range values",
+			pi:          partitionInfo{partitionType: "range", keyColumn: "id"},
+			definitions: []partitionDefinition{{name: "p1", value: "100"}, {name: "p2", value: "250"}, {name: "p3", value: partitionMaxValue}},
+			want: partitionInfo{partitionType: "range", keyColumn: "id", baseName: "p", startNum: "1", values: []string{"100", "250", partitionMaxValue},
+				definitions: []partitionDefinition{{name: "p1", value: "100"}, {name: "p2", value: "250"}, {name: "p3", value: partitionMaxValue}}},
+		},
+		{
+			name: "range interval",
+			pi:   partitionInfo{partitionType: "range", keyColumn: "to_days(created_at)"},
+			definitions: []partitionDefinition{
+				{name: "p202401", value: "TO_DAYS('2024-02-01')"}, {name: "p202402", value: "TO_DAYS('2024-03-01')"}, {name: "pmax", value: partitionMaxValue},
+			},
+			want: partitionInfo{partitionType: "range", keyColumn: "to_days(created_at)", baseName: "p", startNum: "2024-01-01", endNum: "2024-02-01", interval: "month",
+				definitions: []partitionDefinition{
+					{name: "p202401", value: "TO_DAYS('2024-02-01')"}, {name: "p202402", value: "TO_DAYS('2024-03-01')"}, {name: "pmax", value: partitionMaxValue},
+				}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := partitionFromDefinitions(tt.pi, tt.definitions); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcPartitionRolling(t *testing.T) {
+	fromToml := mustParseToml(t, `
+[[tables]]
+name = "logs"
+columns = [{name = "id", type = "int"}, {name = "created_at", type = "datetime"}]
+primary = ["id", "created_at"]
+partition = {type = "range", key = "TO_DAYS(created_at)", basename = "p", interval = "month", start = "2024-01-01", end = "2024-03-01", future = "2", retention = "1"}
+[[tables]]
+name = "items"
+columns = [{name = "id", type = "int"}]
+primary = ["id"]
+partition = {type = "range", key = "id", basename = "p", start = "1", end = "3", each = "100", future = "1", retention = "1"}
+`)
+	// DBは作成時のままのパーティション
+	fromDB := fromToml
+	fromDB.server = testMySQL
+	got, err := procPartitionRolling(fromToml, fromDB, time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC), map[string]int64{"items": 450})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ALTER TABLE logs REORGANIZE PARTITION pmax INTO ( PARTITION p202404 VALUES LESS THAN (TO_DAYS('2024-05-01')), PARTITION p202405 VALUES LESS THAN (TO_DAYS('2024-06-01')), PARTITION p202406 VALUES LESS THAN (TO_DAYS('2024-07-01')), PARTITION pmax VALUES LESS THAN MAXVALUE)",
+		"ALTER TABLE logs DROP PARTITION p202401,p202402",
+		"ALTER TABLE items REORGANIZE PARTITION p3 INTO ( PARTITION p3 VALUES LESS THAN (300), PARTITION p4 VALUES LESS THAN (400), PARTITION p5 VALUES LESS THAN (500), PARTITION p6 VALUES LESS THAN (600), PARTITION p7 VALUES LESS THAN MAXVALUE)",
+		"ALTER TABLE items DROP PARTITION p1,p2,p3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// ALGORITHM, LOCKの指定も付ける
+	fromToml.tablesMap["items"] = tableInfo{name: "items", partition: fromToml.tablesMap["items"].partition, onlineDDL: onlineDDLOption{algorithm: "AUTO"}}
+	fromToml.tables = []tableInfo{fromToml.tablesMap["items"]}
+	got, err = procPartitionRolling(fromToml, fromDB, time.Date(2024, 4, 15, 0, 0, 0, 0, time.UTC), map[string]int64{"items": 450})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1] != "ALTER TABLE items ALGORITHM=INPLACE, DROP PARTITION p1,p2,p3" {
+		t.Errorf("got %q", got)
+	}
+}
+
+// 長期間実行していなかった場合もREORGANIZEで作成したパーティションのうち古いものは同じ実行で削除する
+func TestProcPartitionRollingCatchUp(t *testing.T) {
+	fromToml := mustParseToml(t, `
+[[tables]]
+name = "logs"
+columns = [{name = "id", type = "int"}, {name = "created_at", type = "datetime"}]
+primary = ["id", "created_at"]
+partition = {type = "range", key = "TO_DAYS(created_at)", basename = "p", interval = "month", start = "2024-01-01", end = "2024-01-01", future = "1", retention = "1"}
+[[tables]]
+name = "items"
+columns = [{name = "id", type = "int"}]
+primary = ["id"]
+partition = {type = "range", key = "id", basename = "p", start = "1", end = "2", each = "100", future = "0", retention = "0"}
+`)
+	fromDB := fromToml
+	fromDB.server = testMySQL
+	got, err := procPartitionRolling(fromToml, fromDB, time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC), map[string]int64{"items": 450})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ALTER TABLE logs REORGANIZE PARTITION pmax INTO ( PARTITION p202402 VALUES LESS THAN (TO_DAYS('2024-03-01')), PARTITION p202403 VALUES LESS THAN (TO_DAYS('2024-04-01')), PARTITION p202404 VALUES LESS THAN (TO_DAYS('2024-05-01')), PARTITION p202405 VALUES LESS THAN (TO_DAYS('2024-06-01')), PARTITION p202406 VALUES LESS THAN (TO_DAYS('2024-07-01')), PARTITION p202407 VALUES LESS THAN (TO_DAYS('2024-08-01')), PARTITION pmax VALUES LESS THAN MAXVALUE)",
+		"ALTER TABLE logs DROP PARTITION p202401,p202402,p202403,p202404",
+		"ALTER TABLE items REORGANIZE PARTITION p2 INTO ( PARTITION p2 VALUES LESS THAN (200), PARTITION p3 VALUES LESS THAN (300), PARTITION p4 VALUES LESS THAN (400), PARTITION p5 VALUES LESS THAN (500), PARTITION p6 VALUES LESS THAN MAXVALUE)",
+		"ALTER TABLE items DROP PARTITION p1,p2,p3,p4",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
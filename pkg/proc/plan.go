@@ -0,0 +1,314 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 依存関係がない場合の実行順
+// 以前の固定の実行順をそのまま並び順の基準にしている
+type ddlPhase int
+
+const (
+	phaseDropForeignKey ddlPhase = iota
+	phaseDropTable
+	phaseRenameTable
+	phaseCreateTable
+	phaseRenameColumn
+	phaseRenameIndex
+	phaseRemovePartitioning
+	phaseEngine
+	phaseTableOption
+	phaseDropColumn
+	phaseAddColumn
+	phaseModifyColumn
+	phaseDropIndex
+	phasePrimaryKey
+	phaseAddIndex
+	phasePartition
+	phaseAddForeignKey
+)
+
+// ddlChange 1つのDDLとそれが作成、削除するもの
+// creates, needs, drops, releasesにはtableKeyやcolumnKeyで作ったキーを入れる
+type ddlChange struct {
+	phase     ddlPhase
+	op        ddlOp
+	tableName string
+	query     string   // CREATE TABLEなどALTER TABLE以外の文
+	clause    string   // ALTER TABLEの場合の変更内容 ALTER TABLE tableName clause で実行する
+	creates   []string // このDDLで作成されるもの
+	needs     []string // このDDLの実行前に作成されている必要があるもの
+	drops     []string // このDDLで削除されるもの
+	releases  []string // このDDLで削除されるものが依存していたもの
+
+	standalone       bool         // パーティションの変更など他の変更と同じALTER TABLEにできないもの
+	renamedIndexFrom string       // RENAME INDEXの場合の旧index名
+	bundled          []*ddlChange // 1つのALTER TABLEで実行する必要があるためこの変更にまとめたもの
+}
+
+func (q *Queries) add(c *ddlChange) {
+	if c.clause != "" {
+		// ALTER TABLEはテーブルの作成、RENAME後に実行する
+		c.needs = append(c.needs, tableKey(c.tableName))
+	}
+	q.changes = append(q.changes, c)
+}
+
+// bundle otherをcの後ろに続けて同じALTER TABLEで実行する
+func (c *ddlChange) bundle(other *ddlChange) {
+	c.clause += ", " + other.clause
+	if other.phase < c.phase {
+		c.phase = other.phase
+	}
+	c.creates = append(c.creates, other.creates...)
+	c.drops = append(c.drops, other.drops...)
+	needs := []string{}
+	for _, need := range append(c.needs, other.needs...) {
+		// 同じ文の中で作成されるものは不要
+		if !containsName(c.creates, need) {
+			needs = append(needs, need)
+		}
+	}
+	c.needs = needs
+	releases := []string{}
+	for _, release := range append(c.releases, other.releases...) {
+		// 同じ文の中で引き続き使うものは解放しない
+		if !containsName(c.needs, release) {
+			releases = append(releases, release)
+		}
+	}
+	c.releases = releases
+	c.bundled = append(c.bundled, other)
+	c.bundled = append(c.bundled, other.bundled...)
+}
+
+func tableKey(tableName string) string {
+	return "table:" + tableName
+}
+
+func columnKey(tableName, columnName string) string {
+	return "column:" + tableName + "." + columnName
+}
+
+func columnKeys(tableName string, columnNames []string) []string {
+	result := []string{}
+	for _, columnName := range columnNames {
+		result = append(result, columnKey(tableName, columnName))
+	}
+
+	return result
+}
+
+func indexKey(tableName, indexName string) string {
+	return "index:" + tableName + "." + indexName
+}
+
+// 外部キーの参照先になれるindexはカラム構成で識別する
+func keyKey(tableName string, columnNames []string) string {
+	return "key:" + tableName + "." + strings.Join(columnNames, ",")
+}
+
+// カラムの並び替え
+func columnOrderKey(tableName string) string {
+	return "order:" + tableName
+}
+
+// AUTO_INCREMENTのカラムはそのカラムが先頭になっているindexが必要なので、先頭のカラムでも識別する
+func leadingKey(tableName, columnName string) string {
+	return "lead:" + tableName + "." + columnName
+}
+
+func foreignKeyKey(tableName, fkName string) string {
+	return "fk:" + tableName + "." + fkName
+}
+
+func (c *ddlChange) statement() string {
+	if c.clause == "" {
+		return c.query
+	}
+
+	return fmt.Sprintf(`ALTER TABLE %v %v`, c.tableName, c.clause)
+}
+
+// planDDL 差分のDDLを依存関係グラフにしてトポロジカルソートする
+// 依存関係がないもの同士はphase, 生成順に並べるので何度実行しても同じ順番になる
+// options.mergeAlterが有効な場合は同じテーブルのALTER TABLEを依存関係を崩さない範囲で1文にまとめる
+// ALGORITHM, LOCKの指定がある場合は文ごとに使えるか確認して付ける
+func planDDL(queries *Queries, fromToml schema, server serverInfo) (result []string, err error) {
+	changes := queries.changes
+	// after[i]はchanges[i]より後に、before[i]はchanges[i]より先に実行する必要があるもの
+	after := make([][]int, len(changes))
+	before := make([][]int, len(changes))
+	for i, from := range changes {
+		for j, to := range changes {
+			if i == j {
+				continue
+			}
+			if mustPrecede(from, to) {
+				after[i] = append(after[i], j)
+				before[j] = append(before[j], i)
+			}
+		}
+	}
+
+	sorted, err := sortChanges(changes, after, before)
+	if err != nil {
+		return
+	}
+
+	groups := [][]int{}
+	groupOf := make([]int, len(changes))
+	latestGroup := map[string]int{} // map[tableName]そのテーブルの最後のALTER TABLE
+	for _, i := range sorted {
+		c := changes[i]
+		if fromToml.options.mergeAlter && c.clause != "" && !c.standalone {
+			if gi, exist := latestGroup[c.tableName]; exist && canMerge(changes, before[i], groupOf, gi, c) {
+				groups[gi] = append(groups[gi], i)
+				groupOf[i] = gi
+				continue
+			}
+		}
+		groups = append(groups, []int{i})
+		groupOf[i] = len(groups) - 1
+		if c.clause != "" && !c.standalone {
+			latestGroup[c.tableName] = len(groups) - 1
+		}
+	}
+	for _, group := range groups {
+		first := changes[group[0]]
+		if first.clause == "" {
+			result = append(result, first.statement())
+			continue
+		}
+		groupChanges := []*ddlChange{}
+		for _, i := range group {
+			groupChanges = append(groupChanges, changes[i])
+		}
+		var onlineClauses []string
+		ti := fromToml.tablesMap[first.tableName]
+		onlineClauses, err = buildOnlineDDLClauses(ti.name, tableEngine(ti, server), groupChanges, ti.onlineDDL, server)
+		if err != nil {
+			return
+		}
+		result = append(result, buildAlterStatement(first.tableName, groupChanges, onlineClauses))
+	}
+
+	return
+}
+
+// buildAlterStatement 同じALTER TABLEで実行する変更とALGORITHM, LOCKを1文にする
+// パーティションの変更はALGORITHM, LOCKを後ろに付けるとパーティション名などとして扱われるので前に付ける
+// PARTITION BY, REMOVE PARTITIONINGは変更の一覧とは別の句なのでカンマで区切らない
+// e.g. ALTER TABLE t ALGORITHM=INPLACE, LOCK=SHARED, DROP PARTITION p1, ALTER TABLE t ALGORITHM=COPY PARTITION BY hash (id) PARTITIONS 4
+func buildAlterStatement(tableName string, changes []*ddlChange, onlineClauses []string) string {
+	first := changes[0]
+	if first.standalone && len(onlineClauses) > 0 {
+		separator := ", "
+		if first.op == opRepartition {
+			separator = " "
+		}
+		return fmt.Sprintf(`ALTER TABLE %v %v%v%v`, tableName, strings.Join(onlineClauses, ", "), separator, first.clause)
+	}
+	clauses := []string{}
+	for _, c := range changes {
+		clauses = append(clauses, c.clause)
+	}
+	clauses = append(clauses, onlineClauses...)
+
+	return fmt.Sprintf(`ALTER TABLE %v %v`, tableName, strings.Join(clauses, ", "))
+}
+
+// 依存関係のないもの同士はphaseが小さいもの、phaseが同じなら先に生成されたものから並べる
+func sortChanges(changes []*ddlChange, after, before [][]int) (result []int, err error) {
+	inDegree := make([]int, len(changes))
+	for i := range changes {
+		inDegree[i] = len(before[i])
+	}
+
+	done := make([]bool, len(changes))
+	for len(result) < len(changes) {
+		next := -1
+		for i, c := range changes {
+			if done[i] || inDegree[i] > 0 {
+				continue
+			}
+			if next == -1 || c.phase < changes[next].phase {
+				next = i
+			}
+		}
+		if next == -1 {
+			cycled := []string{}
+			for i, c := range changes {
+				if !done[i] {
+					cycled = append(cycled, c.statement())
+				}
+			}
+			err = errors.New(fmt.Sprintf("dependency cycle detected between queries: %v", strings.Join(cycled, "; ")))
+			return
+		}
+		done[next] = true
+		result = append(result, next)
+		for _, j := range after[next] {
+			inDegree[j]--
+		}
+	}
+
+	return
+}
+
+// 先に実行する必要があるものが全てgroupより前か、同じALTER TABLE内で実行できるならまとめられる
+func canMerge(changes []*ddlChange, predecessors []int, groupOf []int, group int, c *ddlChange) bool {
+	for _, p := range predecessors {
+		if groupOf[p] < group {
+			continue
+		}
+		if groupOf[p] > group {
+			return false
+		}
+		// RENAMEしたカラムは同じALTER TABLE内では古い名前のままなので新しい名前を使う変更はまとめない
+		if changes[p].phase == phaseRenameColumn && intersects(changes[p].creates, c.needs) {
+			return false
+		}
+		// 同名の外部キーのDROPとADDは同じALTER TABLE内では実行できない
+		if changes[p].phase == phaseDropForeignKey && c.phase == phaseAddForeignKey && intersects(changes[p].drops, c.creates) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fromをtoより先に実行する必要があるか
+func mustPrecede(from, to *ddlChange) bool {
+	// 作成されたものを使うDDLは作成後
+	if intersects(from.creates, to.needs) {
+		return true
+	}
+	// 依存されているものは依存している側の削除後に削除する
+	if intersects(from.releases, to.drops) {
+		return true
+	}
+	// 同じものを作り直す場合は削除してから作成する
+	// MODIFYのように1つのDDLで削除と作成をするものは作り直しではないので除く
+	for _, key := range from.drops {
+		if intersects([]string{key}, to.creates) && !intersects([]string{key}, from.creates) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+
+	return false
+}
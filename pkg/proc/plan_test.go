@@ -0,0 +1,205 @@
+package proc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMustPrecede(t *testing.T) {
+	tests := []struct {
+		name string
+		from *ddlChange
+		to   *ddlChange
+		want bool
+	}{
+		{"create before need", &ddlChange{creates: []string{"column:a.x"}}, &ddlChange{needs: []string{"column:a.x"}}, true},
+		{"need after create", &ddlChange{needs: []string{"column:a.x"}}, &ddlChange{creates: []string{"column:a.x"}}, false},
+		{"release before drop", &ddlChange{releases: []string{"column:a.x"}}, &ddlChange{drops: []string{"column:a.x"}}, true},
+		{"drop before create", &ddlChange{drops: []string{"index:a.i"}}, &ddlChange{creates: []string{"index:a.i"}}, true},
+		{"modify is not rebuild", &ddlChange{drops: []string{"column:a.x"}, creates: []string{"column:a.x"}}, &ddlChange{creates: []string{"column:a.x"}}, false},
+		{"unrelated", &ddlChange{creates: []string{"column:a.x"}}, &ddlChange{needs: []string{"column:a.y"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mustPrecede(tt.from, tt.to); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes []*ddlChange
+		want    []int
+		wantErr bool
+	}{
+		{
+			name:    "phase order",
+			changes: []*ddlChange{{phase: phaseAddIndex}, {phase: phaseDropColumn}, {phase: phaseDropForeignKey}},
+			want:    []int{2, 1, 0},
+		},
+		{
+			name:    "same phase keeps generated order",
+			changes: []*ddlChange{{phase: phaseAddIndex}, {phase: phaseAddIndex}, {phase: phaseAddIndex}},
+			want:    []int{0, 1, 2},
+		},
+		{
+			name: "dependency over phase",
+			changes: []*ddlChange{
+				{phase: phaseDropColumn, drops: []string{"column:a.y"}},
+				{phase: phaseDropIndex, drops: []string{"index:a.i"}, releases: []string{"column:a.y"}},
+			},
+			want: []int{1, 0},
+		},
+		{
+			name: "cycle",
+			changes: []*ddlChange{
+				{phase: phaseModifyColumn, clause: "MODIFY", drops: []string{"column:a.x"}, releases: []string{"lead:a.x"}},
+				{phase: phasePrimaryKey, clause: "DROP PRIMARY KEY", drops: []string{"lead:a.x"}, releases: []string{"column:a.x"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := make([][]int, len(tt.changes))
+			before := make([][]int, len(tt.changes))
+			for i, from := range tt.changes {
+				for j, to := range tt.changes {
+					if i != j && mustPrecede(from, to) {
+						after[i] = append(after[i], j)
+						before[j] = append(before[j], i)
+					}
+				}
+			}
+			got, err := sortChanges(tt.changes, after, before)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanMerge(t *testing.T) {
+	dropFK := &ddlChange{phase: phaseDropForeignKey, drops: []string{"fk:a.fk_a_x"}}
+	addFK := &ddlChange{phase: phaseAddForeignKey, creates: []string{"fk:a.fk_a_x"}}
+	addIndex := &ddlChange{phase: phaseAddIndex}
+	changes := []*ddlChange{dropFK, addIndex, addFK}
+	tests := []struct {
+		name         string
+		predecessors []int
+		groupOf      []int
+		group        int
+		c            *ddlChange
+		want         bool
+	}{
+		{"no predecessors", nil, []int{0, 0, 0}, 0, addIndex, true},
+		{"predecessor in earlier group", []int{0}, []int{0, 1, 1}, 1, addIndex, true},
+		{"predecessor in same group", []int{1}, []int{0, 1, 1}, 1, addIndex, true},
+		{"predecessor in later group", []int{1}, []int{0, 2, 1}, 1, addIndex, false},
+		{"same foreign key", []int{0}, []int{0, 0, 0}, 0, addFK, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canMerge(changes, tt.predecessors, tt.groupOf, tt.group, tt.c); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanDDL(t *testing.T) {
+	// indexに含まれるカラムを削除する場合はindexを先に削除してから作り直す
+	toToml := `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "x", type = "int", null = true}]
+primary = ["id"]
+index = ["x"]
+`
+	dbToml := `
+[[tables]]
+name = "a"
+columns = [{name = "id", type = "int"}, {name = "x", type = "int", null = true}, {name = "y", type = "int", null = true}]
+primary = ["id"]
+index = ["x,y"]
+`
+	want := []string{
+		"ALTER TABLE a DROP INDEX idx_a_x_and_y",
+		"ALTER TABLE a DROP COLUMN y",
+		"ALTER TABLE a ADD INDEX idx_a_x (`x`)",
+	}
+	// 何度実行しても同じ順番になる
+	for i := 0; i < 10; i++ {
+		if got := mustPlan(t, toToml, dbToml, testMySQL); !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+
+	to := mustParseToml(t, "[options]\nmerge_alter = true\n"+toToml)
+	db := mustParseToml(t, dbToml)
+	got, err := planDDL(procDiff(to, db), to, testMySQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"ALTER TABLE a DROP INDEX idx_a_x_and_y, DROP COLUMN y, ADD INDEX idx_a_x (`x`)"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestBuildAlterStatement(t *testing.T) {
+	tests := []struct {
+		name          string
+		changes       []*ddlChange
+		onlineClauses []string
+		want          string
+	}{
+		{
+			name:          "merged",
+			changes:       []*ddlChange{{clause: "ADD COLUMN `x` int(11)"}, {clause: "ADD INDEX idx_a_x (`x`)"}},
+			onlineClauses: []string{"ALGORITHM=INPLACE", "LOCK=NONE"},
+			want:          "ALTER TABLE a ADD COLUMN `x` int(11), ADD INDEX idx_a_x (`x`), ALGORITHM=INPLACE, LOCK=NONE",
+		},
+		{
+			name:          "drop partition",
+			changes:       []*ddlChange{newPartitionChange("a", "DROP PARTITION p1,p2")},
+			onlineClauses: []string{"ALGORITHM=INPLACE", "LOCK=SHARED"},
+			want:          "ALTER TABLE a ALGORITHM=INPLACE, LOCK=SHARED, DROP PARTITION p1,p2",
+		},
+		{
+			name:          "reorganize partition",
+			changes:       []*ddlChange{newPartitionChange("a", "REORGANIZE PARTITION p3 INTO ( PARTITION p3 VALUES LESS THAN (300), PARTITION p4 VALUES LESS THAN MAXVALUE)")},
+			onlineClauses: []string{"ALGORITHM=INPLACE"},
+			want:          "ALTER TABLE a ALGORITHM=INPLACE, REORGANIZE PARTITION p3 INTO ( PARTITION p3 VALUES LESS THAN (300), PARTITION p4 VALUES LESS THAN MAXVALUE)",
+		},
+		{
+			name:          "partition by",
+			changes:       []*ddlChange{newPartitionByChange("a", partitionInfo{partitionType: "hash", keyColumn: "id", partitions: "4"}, partitionInfo{})},
+			onlineClauses: []string{"ALGORITHM=COPY", "LOCK=SHARED"},
+			want:          "ALTER TABLE a ALGORITHM=COPY, LOCK=SHARED PARTITION BY hash (id) PARTITIONS 4",
+		},
+		{
+			name:          "remove partitioning",
+			changes:       []*ddlChange{newRemovePartitioningChange("a", partitionInfo{partitionType: "hash", keyColumn: "id"}, nil)},
+			onlineClauses: []string{"ALGORITHM=COPY"},
+			want:          "ALTER TABLE a ALGORITHM=COPY REMOVE PARTITIONING",
+		},
+		{
+			name:    "partition without hint",
+			changes: []*ddlChange{newPartitionChange("a", "COALESCE PARTITION 2")},
+			want:    "ALTER TABLE a COALESCE PARTITION 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildAlterStatement("a", tt.changes, tt.onlineClauses); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package proc
 
 import (
+	"database/sql"
 	"fmt"
+	"time"
 )
 
 func Exec(schemaToml, env, settingToml string, useEmbed, sqlOnly bool) (err error) {
@@ -16,10 +18,14 @@ func Exec(schemaToml, env, settingToml string, useEmbed, sqlOnly bool) (err erro
 		return
 	}
 	queries := procDiff(fromToml, fromDB)
+	statements, err := planDDL(queries, fromToml, fromDB.server)
+	if err != nil {
+		return
+	}
 	if sqlOnly {
-		printDDL(queries)
+		printDDL(statements)
 	} else {
-		err = execDDL(queries)
+		err = execDDL(statements)
 		if err != nil {
 			return
 		}
@@ -28,44 +34,51 @@ func Exec(schemaToml, env, settingToml string, useEmbed, sqlOnly bool) (err erro
 	return
 }
 
-func execDDL(queries *Queries) (err error) {
-	for _, query := range queries.DropTables {
-		_, err = dbConn.Exec(query)
-		if err != nil {
-			return
-		}
+// ExecPartitions schemaのtomlのpartitionにfuture, retentionを指定したテーブルの未来のパーティションを作成し、古いパーティションを削除する
+// cronなどで定期的に実行してください
+func ExecPartitions(schemaToml, env, settingToml string, useEmbed, sqlOnly bool) (err error) {
+	fromToml, err := parseToml(schemaToml, env, settingToml, useEmbed)
+	if err != nil {
+		return
 	}
-	for _, query := range queries.CreateTables {
-		_, err = dbConn.Exec(query)
-		if err != nil {
-			return
-		}
+	connect(fromToml.database)
+	defer dbConn.Close()
+	fromDB, err := parseDB(fromToml.database.Name)
+	if err != nil {
+		return
 	}
-	for _, query := range queries.DropColumns {
-		_, err = dbConn.Exec(query)
-		if err != nil {
-			return
+	keyMaxes := map[string]int64{}
+	for _, ti := range fromToml.tables {
+		if !isRollingPartition(ti.partition) || ti.partition.interval != "" {
+			continue
 		}
-	}
-	for _, query := range queries.AddColumns {
-		_, err = dbConn.Exec(query)
+		var keyMax sql.NullInt64
+		keyMax, err = parseDBPartitionKeyMax(ti.name, ti.partition.keyColumn)
 		if err != nil {
 			return
 		}
-	}
-	for _, query := range queries.ModifyColumns {
-		_, err = dbConn.Exec(query)
-		if err != nil {
-			return
+		if keyMax.Valid {
+			keyMaxes[ti.name] = keyMax.Int64
 		}
 	}
-	for _, query := range queries.DropIndexes {
-		_, err = dbConn.Exec(query)
+	statements, err := procPartitionRolling(fromToml, fromDB, time.Now(), keyMaxes)
+	if err != nil {
+		return
+	}
+	if sqlOnly {
+		printDDL(statements)
+	} else {
+		err = execDDL(statements)
 		if err != nil {
 			return
 		}
 	}
-	for _, query := range queries.AddIndexes {
+
+	return
+}
+
+func execDDL(statements []string) (err error) {
+	for _, query := range statements {
 		_, err = dbConn.Exec(query)
 		if err != nil {
 			return
@@ -75,26 +88,8 @@ func execDDL(queries *Queries) (err error) {
 	return
 }
 
-func printDDL(queries *Queries) {
-	for _, query := range queries.DropTables {
-		fmt.Println(query)
-	}
-	for _, query := range queries.CreateTables {
-		fmt.Println(query)
-	}
-	for _, query := range queries.DropColumns {
-		fmt.Println(query)
-	}
-	for _, query := range queries.AddColumns {
-		fmt.Println(query)
-	}
-	for _, query := range queries.ModifyColumns {
-		fmt.Println(query)
-	}
-	for _, query := range queries.DropIndexes {
-		fmt.Println(query)
-	}
-	for _, query := range queries.AddIndexes {
+func printDDL(statements []string) {
+	for _, query := range statements {
 		fmt.Println(query)
 	}
 }
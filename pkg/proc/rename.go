@@ -0,0 +1,348 @@
+package proc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// applyTableRenames renamed_fromが指定されたテーブルをRENAMEし、DB側の状態をRENAME後のものに書き換える
+// 以降のカラム、indexの差分はRENAME後のテーブルに対して取る
+// 既にRENAME済み(新しい名前のテーブルがDBにある)場合は何もしない
+func applyTableRenames(fromToml, fromDB schema, result *Queries) schema {
+	renamed := false
+	for _, ti := range fromToml.tables {
+		if ti.renamedFrom == "" {
+			continue
+		}
+		if _, exist := fromDB.tablesMap[ti.name]; exist {
+			continue
+		}
+		if _, exist := fromDB.tablesMap[ti.renamedFrom]; !exist {
+			fmt.Println(fmt.Sprintf("WARNING: table: %v renamed_from %v is not found, it will be created as a new table", ti.name, ti.renamedFrom))
+			continue
+		}
+		if !renamed {
+			fromDB = fromDB.clone()
+			renamed = true
+		}
+		renameTable(fromDB, ti.renamedFrom, ti.name, result)
+	}
+
+	return fromDB
+}
+
+// keepGeneratedForeignKeyNames 外部キーはRENAMEできないので、tomlでnameを指定していない外部キーと同じ定義のものが
+// RENAME前のテーブル名などから自動生成された名前(fk_から始まるもの)でDBにある場合はtoml側の名前をDBに合わせる
+// 合わせないとテーブルのRENAME後に毎回外部キーがdrop addされる
+func keepGeneratedForeignKeyNames(fromToml, fromDB schema) schema {
+	cloned := false
+	for _, ti := range fromToml.tables {
+		dbTi, exist := fromDB.tablesMap[ti.name]
+		if !exist {
+			continue
+		}
+		for idx, fk := range ti.foreignKeys {
+			if fk.name != generatedForeignKeyName(ti.name, fk.columns) {
+				continue
+			}
+			if _, exist := findForeignKey(dbTi.foreignKeys, fk.name); exist {
+				continue
+			}
+			for _, dbFK := range dbTi.foreignKeys {
+				if !strings.HasPrefix(dbFK.name, "fk_") {
+					continue
+				}
+				if _, exist := findForeignKey(ti.foreignKeys, dbFK.name); exist {
+					continue
+				}
+				renamed := fk
+				renamed.name = dbFK.name
+				if !reflect.DeepEqual(renamed, dbFK) {
+					continue
+				}
+				if !cloned {
+					fromToml = fromToml.clone()
+					cloned = true
+				}
+				// cloneしたtablesとtablesMapは同じforeignKeysを参照している
+				fromToml.tablesMap[ti.name].foreignKeys[idx].name = dbFK.name
+				break
+			}
+		}
+	}
+
+	return fromToml
+}
+
+func renameTable(fromDB schema, oldName, newName string, result *Queries) {
+	change := &ddlChange{phase: phaseRenameTable, tableName: newName, query: fmt.Sprintf(`RENAME TABLE %v TO %v`, oldName, newName)}
+	change.drops = append(change.drops, tableKey(oldName))
+	change.creates = append(change.creates, tableKey(newName))
+	result.add(change)
+
+	// 外部キーの参照先はDB側で自動で書き換わる
+	for idx, ti := range fromDB.tables {
+		for fkIdx, fk := range ti.foreignKeys {
+			if fk.tableName == oldName {
+				ti.foreignKeys[fkIdx].tableName = newName
+			}
+			if fk.refTable == oldName {
+				ti.foreignKeys[fkIdx].refTable = newName
+			}
+		}
+		if ti.name == oldName {
+			ti.name = newName
+			fromDB.tables[idx] = ti
+		}
+	}
+	ti := fromDB.tablesMap[oldName]
+	ti.name = newName
+	delete(fromDB.tablesMap, oldName)
+	fromDB.tablesMap[newName] = ti
+
+	// テーブル名から自動生成したindex名も新しいテーブル名にRENAME INDEXする
+	// RENAME INDEXが使えない場合はindex名を古いままにしてprocIndexDiffでdrop addさせる
+	renamedSlice := []string{}
+	renamedMap := map[string]*indexInfo{}
+	for _, idxName := range fromDB.indexInfosSlice[oldName] {
+		ii := fromDB.indexInfosMap[oldName][idxName]
+		ii.tableName = newName
+		if canRenameIndex(fromDB.server) {
+			for _, prefix := range []string{"idx_", "ftk_"} {
+				if idxName == generatedIndexName(prefix, oldName, ii.columns) {
+					ii.indexName = generatedIndexName(prefix, newName, ii.columns)
+					result.add(newRenameIndexChange(newName, idxName, ii.indexName, ii.columns))
+				}
+			}
+		}
+		renamedSlice = append(renamedSlice, ii.indexName)
+		renamedMap[ii.indexName] = ii
+	}
+	delete(fromDB.indexInfosSlice, oldName)
+	delete(fromDB.indexInfosMap, oldName)
+	fromDB.indexInfosSlice[newName] = renamedSlice
+	fromDB.indexInfosMap[newName] = renamedMap
+}
+
+// applyColumnRenames renamed_fromが指定されたカラムをRENAMEし、DB側の状態をRENAME後のものに書き換える
+// 以降の差分はRENAME後のDBに対して取るので、定義の変更があればMODIFYになりindexはそのまま残る
+// 既にRENAME済み(新しい名前のカラムがDBにある)場合は何もしない
+func applyColumnRenames(fromToml, fromDB schema, result *Queries) schema {
+	renamed := false
+	for _, ti := range fromToml.tables {
+		if len(ti.columnRenames) == 0 {
+			continue
+		}
+		if _, exist := fromDB.tablesMap[ti.name]; !exist {
+			continue
+		}
+		for _, tc := range ti.columns {
+			oldName, exist := ti.columnRenames[tc.name]
+			if !exist {
+				continue
+			}
+			dbTi := fromDB.tablesMap[ti.name]
+			if _, exist := dbTi.columnsMap[tc.name]; exist {
+				continue
+			}
+			dbTc, exist := dbTi.columnsMap[oldName]
+			if !exist {
+				fmt.Println(fmt.Sprintf("WARNING: table: %v column: %v renamed_from %v is not found, it will be added as a new column", ti.name, tc.name, oldName))
+				continue
+			}
+			if !renamed {
+				fromDB = fromDB.clone()
+				renamed = true
+			}
+			renamedTc := renameColumn(fromDB, ti.name, oldName, tc, dbTc, result)
+			renameIndexColumns(fromDB, ti.name, oldName, renamedTc.name, result)
+		}
+	}
+
+	return fromDB
+}
+
+// RENAME COLUMNはmysql8.0.3, mariadb10.5.2から 使えない場合は定義ごとCHANGE COLUMNする
+// 定義も変わる場合はRENAMEとMODIFYを同じALTER TABLEにまとめると新しいカラム名が見つからないエラーになるので、
+// RENAME COLUMNが使える場合も1つのCHANGE COLUMNにする
+func renameColumn(fromDB schema, tableName, oldName string, tc, dbTc tableColumn, result *Queries) (renamedTc tableColumn) {
+	server := fromDB.server
+	renamedTc = dbTc
+	renamedTc.name = tc.name
+	// procTableDiffと同じくcharset, collationを指定していない場合はDBのものを引き継ぐ
+	tc = inheritColumnCharset(resolveColumnTypeAlias(tc, server), dbTc)
+	canonicalTc := canonicalizeColumn(tc, server)
+	modified := !reflect.DeepEqual(comparableDefault(renamedTc), comparableDefault(canonicalTc))
+	change := &ddlChange{phase: phaseRenameColumn, op: opRenameColumn, tableName: tableName}
+	if !modified && ((!server.isMariaDB() && server.atLeast(8, 0, 3)) || (server.isMariaDB() && server.atLeast(10, 5, 2))) {
+		change.clause = fmt.Sprintf("RENAME COLUMN `%v` TO `%v`", oldName, tc.name)
+	} else {
+		change.clause = fmt.Sprintf("CHANGE COLUMN `%v` %v", oldName, buildColumnDefinition(tc))
+		if modified {
+			change.op = classifyModify(renamedTc, canonicalTc)
+		}
+		renamedTc = canonicalTc
+	}
+	change.needs = append(change.needs, columnKey(tableName, oldName))
+	change.drops = append(change.drops, columnKey(tableName, oldName))
+	change.creates = append(change.creates, columnKey(tableName, tc.name))
+	result.add(change)
+
+	ti := fromDB.tablesMap[tableName]
+	for idx, column := range ti.columns {
+		if column.name == oldName {
+			ti.columns[idx] = renamedTc
+		}
+	}
+	delete(ti.columnsMap, oldName)
+	ti.columnsMap[renamedTc.name] = renamedTc
+	for idx, fk := range ti.foreignKeys {
+		ti.foreignKeys[idx].columns = replaceName(fk.columns, oldName, renamedTc.name)
+	}
+	fromDB.tablesMap[tableName] = ti
+	// 他のテーブルからの外部キーの参照先もDB側で自動で書き換わる
+	for _, other := range fromDB.tables {
+		for idx, fk := range other.foreignKeys {
+			if fk.refTable == tableName {
+				other.foreignKeys[idx].refColumns = replaceName(fk.refColumns, oldName, renamedTc.name)
+			}
+		}
+	}
+
+	return
+}
+
+// indexのカラムはDB側で自動で書き換わるが、カラム名から自動生成したindex名は古いままなのでRENAME INDEXする
+// RENAME INDEXが使えない場合はindex名を古いままにしてprocIndexDiffでdrop addさせる
+func renameIndexColumns(fromDB schema, tableName, oldName, newName string, result *Queries) {
+	renamedSlice := []string{}
+	for _, idxName := range fromDB.indexInfosSlice[tableName] {
+		ii := fromDB.indexInfosMap[tableName][idxName]
+		if !containsName(ii.columns, oldName) {
+			renamedSlice = append(renamedSlice, idxName)
+			continue
+		}
+		newColumns := replaceName(ii.columns, oldName, newName)
+		newIdxName := idxName
+		if canRenameIndex(fromDB.server) && idxName != "PRIMARY" {
+			for _, prefix := range []string{"idx_", "ftk_"} {
+				if idxName == generatedIndexName(prefix, tableName, ii.columns) {
+					newIdxName = generatedIndexName(prefix, tableName, newColumns)
+				}
+			}
+		}
+		if newIdxName != idxName {
+			if renamed := findRenameIndexChange(result, tableName, idxName); renamed != nil {
+				// テーブルのRENAMEで既にRENAME INDEXしている場合はその変更先を書き換える
+				*renamed = *newRenameIndexChange(tableName, renamed.renamedIndexFrom, newIdxName, newColumns)
+			} else {
+				result.add(newRenameIndexChange(tableName, idxName, newIdxName, newColumns))
+			}
+			delete(fromDB.indexInfosMap[tableName], idxName)
+		}
+		ii.indexName = newIdxName
+		ii.columns = newColumns
+		fromDB.indexInfosMap[tableName][newIdxName] = ii
+		renamedSlice = append(renamedSlice, newIdxName)
+	}
+	fromDB.indexInfosSlice[tableName] = renamedSlice
+}
+
+// RENAME INDEXはmysql5.7, mariadb10.5.2から
+func canRenameIndex(server serverInfo) bool {
+	return (!server.isMariaDB() && server.atLeast(5, 7, 0)) || (server.isMariaDB() && server.atLeast(10, 5, 2))
+}
+
+func newRenameIndexChange(tableName, oldIdxName, newIdxName string, columns []string) *ddlChange {
+	result := &ddlChange{phase: phaseRenameIndex, op: opRenameIndex, tableName: tableName}
+	result.clause = fmt.Sprintf("RENAME INDEX `%v` TO `%v`", oldIdxName, newIdxName)
+	result.needs = append(result.needs, columnKeys(tableName, columns)...)
+	result.drops = append(result.drops, indexKey(tableName, oldIdxName))
+	result.creates = append(result.creates, indexKey(tableName, newIdxName))
+	result.renamedIndexFrom = oldIdxName
+	result.needs = append(result.needs, tableKey(tableName))
+
+	return result
+}
+
+func findRenameIndexChange(queries *Queries, tableName, idxName string) *ddlChange {
+	for _, c := range queries.changes {
+		if c.phase == phaseRenameIndex && c.tableName == tableName && intersects(c.creates, []string{indexKey(tableName, idxName)}) {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func generatedIndexName(prefix, tableName string, columns []string) string {
+	return prefix + tableName + "_" + strings.Join(columns, "_and_")
+}
+
+func generatedForeignKeyName(tableName string, columns []string) string {
+	return generatedIndexName("fk_", tableName, columns)
+}
+
+func replaceName(names []string, oldName, newName string) []string {
+	result := []string{}
+	for _, name := range names {
+		if name == oldName {
+			name = newName
+		}
+		result = append(result, name)
+	}
+
+	return result
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RENAMEでDB側の状態を書き換えるときに呼び出し元のschemaを壊さないようにコピーする
+func (s schema) clone() schema {
+	result := s
+	result.tables = []tableInfo{}
+	result.tablesMap = map[string]tableInfo{}
+	result.indexInfosSlice = map[string][]string{}
+	result.indexInfosMap = map[string]map[string]*indexInfo{}
+	for _, ti := range s.tables {
+		cloned := ti
+		cloned.columns = append([]tableColumn{}, ti.columns...)
+		cloned.columnsMap = map[string]tableColumn{}
+		for name, tc := range ti.columnsMap {
+			cloned.columnsMap[name] = tc
+		}
+		cloned.foreignKeys = []foreignKeyInfo{}
+		for _, fk := range ti.foreignKeys {
+			fk.columns = append([]string{}, fk.columns...)
+			fk.refColumns = append([]string{}, fk.refColumns...)
+			cloned.foreignKeys = append(cloned.foreignKeys, fk)
+		}
+		if ti.foreignKeys == nil {
+			cloned.foreignKeys = nil
+		}
+		result.tables = append(result.tables, cloned)
+		result.tablesMap[cloned.name] = cloned
+	}
+	for tableName, idxes := range s.indexInfosSlice {
+		result.indexInfosSlice[tableName] = append([]string{}, idxes...)
+	}
+	for tableName, idxesMap := range s.indexInfosMap {
+		result.indexInfosMap[tableName] = map[string]*indexInfo{}
+		for idxName, ii := range idxesMap {
+			cloned := *ii
+			cloned.columns = append([]string{}, ii.columns...)
+			result.indexInfosMap[tableName][idxName] = &cloned
+		}
+	}
+
+	return result
+}
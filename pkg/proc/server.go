@@ -0,0 +1,79 @@
+package proc
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var serverVersionReg = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
+
+// 接続先のDBの種類とバージョン
+type serverInfo struct {
+	flavor        string // mysql or mariadb
+	major         int
+	minor         int
+	patch         int
+	defaultEngine string // tomlでengineを指定していないテーブルのengine
+	// tomlでcharset, collationを指定していないテーブルのcharset, collation
+	defaultCharset   string
+	defaultCollation string
+}
+
+func detectServer() (result serverInfo, err error) {
+	var version string
+	err = dbConn.QueryRow("SELECT VERSION()").Scan(&version)
+	if err != nil {
+		return
+	}
+	result = parseServerVersion(version)
+	err = dbConn.QueryRow("SELECT @@default_storage_engine").Scan(&result.defaultEngine)
+	if err != nil {
+		return
+	}
+	result.defaultEngine = normalizeEngine(result.defaultEngine)
+	err = dbConn.QueryRow("SELECT @@character_set_database, @@collation_database").Scan(&result.defaultCharset, &result.defaultCollation)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// e.g. 8.0.34, 10.6.12-MariaDB-1:10.6.12+maria~ubu2004-log, 5.5.5-10.3.38-MariaDB
+func parseServerVersion(version string) (result serverInfo) {
+	result = serverInfo{flavor: "mysql"}
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		result.flavor = "mariadb"
+		// レプリケーション互換のため5.5.5-が先頭についていることがある
+		version = strings.TrimPrefix(version, "5.5.5-")
+	}
+	res := serverVersionReg.FindStringSubmatch(version)
+	if len(res) < 4 {
+		return
+	}
+	result.major, _ = strconv.Atoi(res[1])
+	result.minor, _ = strconv.Atoi(res[2])
+	result.patch, _ = strconv.Atoi(res[3])
+
+	return
+}
+
+func (s serverInfo) isMariaDB() bool {
+	return s.flavor == "mariadb"
+}
+
+func (s serverInfo) atLeast(major, minor, patch int) bool {
+	if s.major != major {
+		return s.major > major
+	}
+	if s.minor != minor {
+		return s.minor > minor
+	}
+
+	return s.patch >= patch
+}
+
+func (s serverInfo) String() string {
+	return s.flavor + " " + strconv.Itoa(s.major) + "." + strconv.Itoa(s.minor) + "." + strconv.Itoa(s.patch)
+}
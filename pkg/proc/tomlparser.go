@@ -6,6 +6,7 @@ import (
 	"github.com/BurntSushi/toml"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
+	"strconv"
 	"strings"
 )
 
@@ -78,6 +79,13 @@ func parseToml(schemaToml, env, settingToml string, useEmbed bool) (result schem
 		result.database.Collation = "utf8mb4_general_ci"
 	}
 
+	if optionsIF, exist := parsed["options"]; exist {
+		result.options, err = parseOptions(optionsIF.(map[string]interface{}))
+		if err != nil {
+			return
+		}
+	}
+
 	tablesSliceIF, ok := parsed["tables"].([]map[string]interface{})
 	if !ok {
 		err = errors.New("tables are not found")
@@ -91,6 +99,10 @@ func parseToml(schemaToml, env, settingToml string, useEmbed bool) (result schem
 		if err != nil {
 			return
 		}
+		ti.onlineDDL, err = parseOnlineDDLOption(tableIFMap, result.options.onlineDDL)
+		if err != nil {
+			return
+		}
 		result.tables = append(result.tables, ti)
 		result.tablesMap[ti.name] = ti
 		result.indexInfosMap[ti.name] = indexInfos
@@ -106,6 +118,23 @@ func parseToml(schemaToml, env, settingToml string, useEmbed bool) (result schem
 	return
 }
 
+func parseOptions(optionsMap map[string]interface{}) (result schemaOptions, err error) {
+	result = schemaOptions{}
+
+	if optionIF, exist := optionsMap["merge_alter"]; exist {
+		result.mergeAlter = optionIF.(bool)
+	}
+	if optionIF, exist := optionsMap["sync_column_order"]; exist {
+		result.syncColumnOrder = optionIF.(bool)
+	}
+	result.onlineDDL, err = parseOnlineDDLOption(optionsMap, onlineDDLOption{})
+	if err != nil {
+		return
+	}
+
+	return
+}
+
 func parseTables(tableIFMap map[string]interface{}) (result tableInfo, indexInfos map[string]*indexInfo, indexSlice []string, err error) {
 	result = tableInfo{
 		columnsMap: map[string]tableColumn{},
@@ -121,6 +150,10 @@ func parseTables(tableIFMap map[string]interface{}) (result tableInfo, indexInfo
 		return
 	}
 
+	if renamedFromIF, exist := tableIFMap["renamed_from"]; exist {
+		result.renamedFrom = renamedFromIF.(string)
+	}
+
 	if columnsIF, exist := tableIFMap["columns"]; exist {
 		columnsSliceIF := columnsIF.([]interface{})
 		for _, columnsMapIF := range columnsSliceIF {
@@ -132,6 +165,12 @@ func parseTables(tableIFMap map[string]interface{}) (result tableInfo, indexInfo
 			}
 			result.columns = append(result.columns, tc)
 			result.columnsMap[tc.name] = tc
+			if renamedFromIF, exist := columnsMap["renamed_from"]; exist {
+				if result.columnRenames == nil {
+					result.columnRenames = map[string]string{}
+				}
+				result.columnRenames[tc.name] = renamedFromIF.(string)
+			}
 		}
 	} else {
 		err = errors.New("require table.columns")
@@ -153,6 +192,16 @@ func parseTables(tableIFMap map[string]interface{}) (result tableInfo, indexInfo
 			indexSlice = append(indexSlice, "PRIMARY")
 		}
 	}
+	if _, exist := indexInfos["PRIMARY"]; !exist {
+		// primaryの指定がなくauto_incがある場合はCREATE時にそのカラムがprimaryになるのでindexにも入れておく
+		for _, tc := range result.columns {
+			if tc.autoInc {
+				indexInfos["PRIMARY"] = &indexInfo{tableName: result.name, unique: true, indexName: "PRIMARY", indexType: "BTREE", columns: []string{tc.name}}
+				indexSlice = append(indexSlice, "PRIMARY")
+				break
+			}
+		}
+	}
 	if indexIF, exist := tableIFMap["index"]; exist {
 		indexes := indexIF.([]interface{})
 		for _, idx := range indexes {
@@ -198,7 +247,13 @@ func parseTables(tableIFMap map[string]interface{}) (result tableInfo, indexInfo
 	if ftkIF, exist := tableIFMap["fulltext_index"]; exist {
 		indexes := ftkIF.([]interface{})
 		for _, idx := range indexes {
-			indexesString := idx.(string)
+			// カラムだけの文字列か、tokenizerなどを指定する場合は{columns = "", tokenizer = ""}
+			var indexesString string
+			var fulltext fulltextOption
+			indexesString, fulltext, err = parseFullTextIndex(idx)
+			if err != nil {
+				return
+			}
 			if indexesString == "" {
 				continue
 			}
@@ -206,17 +261,43 @@ func parseTables(tableIFMap map[string]interface{}) (result tableInfo, indexInfo
 			indexName := "ftk_" + result.name + "_" + strings.Join(indexesSlice, "_and_")
 			if _, exist := indexInfos[indexName]; !exist {
 				indexInfos[indexName] = &indexInfo{tableName: result.name, indexName: indexName, indexType: "FULLTEXT", columns: []string{}}
-				indexInfos[indexName].comment = `'tokenizer "TokenBigramSplitSymbolAlphaDigit"'`
+				indexInfos[indexName].fulltext = fulltext
 			}
 			indexInfos[indexName].columns = append(indexInfos[indexName].columns, indexesSlice...)
 			indexSlice = append(indexSlice, indexName)
 		}
 	}
+	for _, tc := range result.columns {
+		if !tc.autoInc {
+			continue
+		}
+		// auto_incのカラムはいずれかのindexの先頭のカラムになっている必要がある
+		indexed := false
+		for _, ii := range indexInfos {
+			if ii.columns[0] == tc.name {
+				indexed = true
+			}
+		}
+		if !indexed {
+			err = errors.New(fmt.Sprintf("table: %v column: %v AUTO_INCREMENT column must be the first column of primary or index", result.name, tc.name))
+			return
+		}
+	}
 	if engineIF, exist := tableIFMap["engine"]; exist {
-		// 一旦Mroongaのみ対応
-		engine := strings.ToLower(engineIF.(string))
-		engine = cases.Title(language.Und).String(engine)
-		result.engine = "Mroonga"
+		result.engine = normalizeEngine(engineIF.(string))
+	}
+	if engineOptionIF, exist := tableIFMap["engine_options"]; exist {
+		if result.engine != "" && !isMroonga(result.engine) {
+			err = errors.New(fmt.Sprintf("table: %v engine_options is only for Mroonga", result.name))
+			return
+		}
+		result.engineOption = parseEngineOption(engineOptionIF.(map[string]interface{}))
+	}
+	result.tableOption = parseTableOption(tableIFMap)
+	if result.tableOption.comment != "" && buildEngineComment(result.engineOption) != "" {
+		// MroongaはテーブルのCOMMENTにengine_optionsを書く
+		err = errors.New(fmt.Sprintf("table: %v comment can not be used with engine_options", result.name))
+		return
 	}
 	if partitionIF, exist := tableIFMap["partition"]; exist {
 		partitionMap := partitionIF.(map[string]interface{})
@@ -225,6 +306,18 @@ func parseTables(tableIFMap map[string]interface{}) (result tableInfo, indexInfo
 			return
 		}
 	}
+	if fkIF, exist := tableIFMap["foreign_keys"]; exist {
+		fkSliceIF := fkIF.([]interface{})
+		for _, fkMapIF := range fkSliceIF {
+			fkMap := fkMapIF.(map[string]interface{})
+			var fk foreignKeyInfo
+			fk, err = parseForeignKey(result.name, fkMap)
+			if err != nil {
+				return
+			}
+			result.foreignKeys = append(result.foreignKeys, fk)
+		}
+	}
 
 	return
 }
@@ -240,6 +333,7 @@ func parseColumns(columnsMap map[string]interface{}) (result tableColumn, err er
 	}
 	if columnIF, exist := columnsMap["type"]; exist {
 		result.columnType = strings.ToLower(columnIF.(string))
+		result = resolveColumnTypeAlias(result, serverInfo{})
 	} else {
 		err = errors.New("require table.column.type")
 		return
@@ -247,42 +341,62 @@ func parseColumns(columnsMap map[string]interface{}) (result tableColumn, err er
 	if columnIF, exist := columnsMap["unsigned"]; exist {
 		result.unsigned = columnIF.(bool)
 	}
-	if columnIF, exist := columnsMap["size"]; exist {
+	if columnIF, exist := columnsMap["values"]; exist {
+		if !isEnumType(result.columnType) {
+			err = errors.New(fmt.Sprintf("column: %v values is only for enum and set", result.name))
+			return
+		}
+		for _, valueIF := range columnIF.([]interface{}) {
+			result.values = append(result.values, valueIF.(string))
+		}
+	}
+	if columnIF, exist := columnsMap["size"]; exist && isEnumType(result.columnType) {
+		if len(result.values) > 0 {
+			// DBのenum, setにはsizeがないので両方指定すると毎回MODIFYになる
+			err = errors.New(fmt.Sprintf("column: %v size and values cannot be used together, please specify only values", result.name))
+			return
+		}
+		// 以前のsizeに'a','b'と書く指定
+		result.values, err = parseEnumValues(columnIF.(string))
+		if err != nil {
+			return
+		}
+	} else if exist {
 		result.size = columnIF.(string)
 	} else {
 		if result.columnType == "char" || result.columnType == "varchar" {
 			err = errors.New(fmt.Sprintf("column type %v require size", result.columnType))
 			return
 		}
-		switch result.columnType {
-		case "int":
-			if result.unsigned {
-				result.size = "10"
-			} else {
-				result.size = "11"
-			}
-		case "bigint":
-			result.size = "20"
-		case "tinyint":
-			if result.unsigned {
-				result.size = "3"
-			} else {
-				result.size = "4"
-			}
-		case "smallint":
-			if result.unsigned {
-				result.size = "5"
-			} else {
-				result.size = "6"
-			}
-		case "mediumint":
-			if result.unsigned {
-				result.size = "8"
-			} else {
-				result.size = "9"
-			}
+		if isEnumType(result.columnType) && len(result.values) == 0 {
+			err = errors.New(fmt.Sprintf("column type %v require values", result.columnType))
+			return
 		}
 	}
+	for _, name := range []string{"precision", "scale", "fsp"} {
+		columnIF, exist := columnsMap[name]
+		if !exist {
+			continue
+		}
+		if name == "fsp" && !isTemporalType(result.columnType) {
+			err = errors.New(fmt.Sprintf("column: %v fsp is only for datetime, timestamp and time", result.name))
+			return
+		}
+		if name != "fsp" && !isPrecisionType(result.columnType) {
+			err = errors.New(fmt.Sprintf("column: %v %v is only for decimal, float and double", result.name, name))
+			return
+		}
+		switch name {
+		case "precision":
+			result.precision = columnIF.(string)
+		case "scale":
+			result.scale = columnIF.(string)
+		case "fsp":
+			result.fsp = columnIF.(string)
+		}
+	}
+	// 接続先のDBによるものはprocDiffでもう一度canonicalizeColumnする
+	result = canonicalizeColumn(result, serverInfo{})
 	if columnIF, exist := columnsMap["autoinc"]; exist {
 		result.autoInc = columnIF.(bool)
 	}
@@ -290,57 +404,333 @@ func parseColumns(columnsMap map[string]interface{}) (result tableColumn, err er
 		result.null = columnIF.(bool)
 	}
 	// emptyを明示的に設定したいかどうかの判別
-	dd := defaultDetail{}
 	if columnIF, exist := columnsMap["default"]; exist {
-		dd.need = true
-		dd.value = columnIF.(string)
+		result.defaultValue = parseTomlDefault(columnIF.(string))
+	}
+	if columnIF, exist := columnsMap["default_expr"]; exist {
+		if _, dup := columnsMap["default"]; dup {
+			err = errors.New(fmt.Sprintf("column: %v default and default_expr cannot be used together", result.name))
+			return
+		}
+		result.defaultValue = parseTomlDefaultExpr(columnIF.(string))
+		if result.defaultValue.kind == defaultNull && !result.null {
+			err = errors.New(fmt.Sprintf("column: %v default_expr NULL needs null = true", result.name))
+			return
+		}
+	}
+	if columnIF, exist := columnsMap["on_update"]; exist {
+		if result.columnType != "datetime" && result.columnType != "timestamp" {
+			err = errors.New(fmt.Sprintf("column: %v on_update is only for datetime and timestamp", result.name))
+			return
+		}
+		var ok bool
+		result.onUpdate, ok = parseTomlOnUpdate(columnIF.(string))
+		if !ok {
+			err = errors.New(fmt.Sprintf("column: %v on_update: %v is not CURRENT_TIMESTAMP", result.name, columnIF))
+			return
+		}
+	}
+	if columnIF, exist := columnsMap["charset"]; exist {
+		result.charset = strings.ToLower(columnIF.(string))
+	}
+	if columnIF, exist := columnsMap["collation"]; exist {
+		result.collation = strings.ToLower(columnIF.(string))
+	}
+	if columnIF, exist := columnsMap["comment"]; exist {
+		result.comment = columnIF.(string)
+	}
+
+	return
+}
+
+// tokenizer, normalizer, token_filtersはMroonga、parserはそれ以外のengineの場合のみ使う(resolveFullTextOptions)
+func parseFullTextIndex(idx interface{}) (columns string, result fulltextOption, err error) {
+	idxMap, ok := idx.(map[string]interface{})
+	if !ok {
+		columns = idx.(string)
+		return
+	}
+	if columnsIF, exist := idxMap["columns"]; exist {
+		columns = columnsIF.(string)
 	} else {
-		dd.need = false
+		err = errors.New("require fulltext_index.columns")
+		return
+	}
+	if tokenizerIF, exist := idxMap["tokenizer"]; exist {
+		result.tokenizer = tokenizerIF.(string)
+	}
+	if normalizerIF, exist := idxMap["normalizer"]; exist {
+		result.normalizer = normalizerIF.(string)
+	}
+	if tokenFiltersIF, exist := idxMap["token_filters"]; exist {
+		for _, tokenFilterIF := range tokenFiltersIF.([]interface{}) {
+			result.tokenFilters = append(result.tokenFilters, tokenFilterIF.(string))
+		}
+	}
+	if parserIF, exist := idxMap["parser"]; exist {
+		result.parser = strings.ToLower(parserIF.(string))
 	}
-	result.defaultValue = dd
 
 	return
 }
 
+func parseEngineOption(engineOptionMap map[string]interface{}) (result engineOption) {
+	if engineIF, exist := engineOptionMap["engine"]; exist {
+		result.wrappedEngine = normalizeEngine(engineIF.(string))
+	}
+	if tokenizerIF, exist := engineOptionMap["default_tokenizer"]; exist {
+		result.defaultTokenizer = tokenizerIF.(string)
+	}
+	if normalizerIF, exist := engineOptionMap["normalizer"]; exist {
+		result.normalizer = normalizerIF.(string)
+	}
+	if tokenFiltersIF, exist := engineOptionMap["token_filters"]; exist {
+		for _, tokenFilterIF := range tokenFiltersIF.([]interface{}) {
+			result.tokenFilters = append(result.tokenFilters, tokenFilterIF.(string))
+		}
+	}
+
+	return
+}
+
+// charset, collationはDBが返す小文字、row_format, stats_persistentは大文字に揃える
+func parseTableOption(tableIFMap map[string]interface{}) (result tableOption) {
+	if charsetIF, exist := tableIFMap["charset"]; exist {
+		result.charset = strings.ToLower(charsetIF.(string))
+	}
+	if collationIF, exist := tableIFMap["collation"]; exist {
+		result.collation = strings.ToLower(collationIF.(string))
+	}
+	if commentIF, exist := tableIFMap["comment"]; exist {
+		result.comment = commentIF.(string)
+	}
+	if rowFormatIF, exist := tableIFMap["row_format"]; exist {
+		result.rowFormat = strings.ToUpper(rowFormatIF.(string))
+	}
+	if keyBlockSizeIF, exist := tableIFMap["key_block_size"]; exist {
+		result.keyBlockSize = keyBlockSizeIF.(string)
+	}
+	if statsPersistentIF, exist := tableIFMap["stats_persistent"]; exist {
+		result.statsPersistent = strings.ToUpper(statsPersistentIF.(string))
+	}
+	if autoIncrementIF, exist := tableIFMap["auto_increment"]; exist {
+		result.autoIncrement = autoIncrementIF.(string)
+	}
+
+	return
+}
+
+// DBが返すengine名に揃える
+var engineNames = map[string]string{
+	"innodb":    "InnoDB",
+	"myisam":    "MyISAM",
+	"aria":      "Aria",
+	"rocksdb":   "ROCKSDB",
+	"mroonga":   "Mroonga",
+	"archive":   "ARCHIVE",
+	"memory":    "MEMORY",
+	"csv":       "CSV",
+	"blackhole": "BLACKHOLE",
+}
+
+func normalizeEngine(engine string) string {
+	if name, exist := engineNames[strings.ToLower(engine)]; exist {
+		return name
+	}
+
+	return cases.Title(language.Und).String(strings.ToLower(engine))
+}
+
 // 入力ミス関係のチェックはしてないので注意
 func parsePartition(partitionMap map[string]interface{}) (result partitionInfo, err error) {
 	result = partitionInfo{}
 
 	if pIF, exist := partitionMap["type"]; exist {
-		result.partitionType = strings.ToLower(pIF.(string))
+		result.partitionType = normalizePartitionType(pIF.(string))
 	} else {
 		err = errors.New("require partition.type")
 		return
 	}
-	result.partitionType = "range" // 2021-06-16 range固定
+	if _, exist := partitionTypes[result.partitionType]; !exist {
+		err = errors.New(fmt.Sprintf("unsupported partition.type: %v", result.partitionType))
+		return
+	}
 
 	if pIF, exist := partitionMap["key"]; exist {
-		result.keyColumn = strings.ToLower(pIF.(string))
+		result.keyColumn = normalizePartitionKey(pIF.(string))
 	} else {
 		err = errors.New("require partition.key")
 		return
 	}
+	if _, exist := partitionMap["subpartition_type"]; exist && isHashPartition(result) {
+		err = errors.New("partition.subpartition_type require range or list partition")
+		return
+	}
+	if isHashPartition(result) {
+		// hash, keyはパーティションの数だけ
+		if pIF, exist := partitionMap["partitions"]; exist {
+			result.partitions = pIF.(string)
+		} else {
+			err = errors.New(fmt.Sprintf("partition.type %v require partition.partitions", result.partitionType))
+			return
+		}
+		result.definitions = partitionDefinitions(result)
+		return
+	}
+	if pIF, exist := partitionMap["subpartition_type"]; exist {
+		result.subPartitionType = normalizePartitionType(pIF.(string))
+		if !isHashPartition(partitionInfo{partitionType: result.subPartitionType}) {
+			err = errors.New(fmt.Sprintf("unsupported partition.subpartition_type: %v", result.subPartitionType))
+			return
+		}
+		for _, name := range []string{"subpartition_key", "subpartitions"} {
+			if _, exist := partitionMap[name]; !exist {
+				err = errors.New(fmt.Sprintf("partition.subpartition_type require partition.%v", name))
+				return
+			}
+		}
+		result.subPartitionKey = normalizePartitionKey(partitionMap["subpartition_key"].(string))
+		result.subPartitions = partitionMap["subpartitions"].(string)
+	}
 	if pIF, exist := partitionMap["basename"]; exist {
 		result.baseName = strings.ToLower(pIF.(string))
 	} else {
 		err = errors.New("require partition.basename")
 		return
 	}
+	for _, name := range []string{"future", "retention"} {
+		pIF, exist := partitionMap[name]
+		if !exist {
+			continue
+		}
+		if _, convErr := strconv.Atoi(pIF.(string)); convErr != nil {
+			err = errors.New(fmt.Sprintf("partition.%v must be number: %v", name, pIF))
+			return
+		}
+		if name == "future" {
+			result.future = pIF.(string)
+		} else {
+			result.retention = pIF.(string)
+		}
+	}
+	if pIF, exist := partitionMap["interval"]; exist {
+		// 日付で区切る
+		result.interval = strings.ToLower(pIF.(string))
+		if _, exist := partitionIntervalNameFormats[result.interval]; !exist {
+			err = errors.New(fmt.Sprintf("unsupported partition.interval: %v", result.interval))
+			return
+		}
+		if !isRangePartition(result) || (partitionKeyFunction(result) == "" && result.partitionType != "range columns") {
+			err = errors.New("partition.interval require range partition by TO_DAYS, TO_SECONDS, UNIX_TIMESTAMP or range columns")
+			return
+		}
+		for _, name := range []string{"start", "end"} {
+			pIF, exist := partitionMap[name]
+			if !exist {
+				err = errors.New(fmt.Sprintf("partition.interval require partition.%v", name))
+				return
+			}
+			if _, err = parsePartitionDate(pIF.(string)); err != nil {
+				err = errors.New(fmt.Sprintf("partition.%v must be date: %v", name, pIF))
+				return
+			}
+		}
+		result.startNum = partitionMap["start"].(string)
+		result.endNum = partitionMap["end"].(string)
+		result.definitions = partitionDefinitions(result)
+		return
+	}
 	if pIF, exist := partitionMap["start"]; exist {
 		result.startNum = pIF.(string)
+	} else {
+		result.startNum = "1"
+	}
+	if pIF, exist := partitionMap["values"]; exist {
+		// 区切りが一定でない場合やlistはvaluesで全て指定する
+		for _, valueIF := range pIF.([]interface{}) {
+			result.values = append(result.values, normalizePartitionValue(valueIF.(string)))
+		}
+		if len(result.values) == 0 {
+			err = errors.New("partition.values must not be empty")
+			return
+		}
+		if isRollingPartition(result) {
+			err = errors.New("partition.future and partition.retention require partition.interval or partition.each")
+			return
+		}
+		result.definitions = partitionDefinitions(result)
+		return
+	}
+	if result.partitionType != "range" {
+		err = errors.New(fmt.Sprintf("partition.type %v require partition.values", result.partitionType))
+		return
 	}
-	result.startNum = "1" // 2021-06-16 一旦1固定
-
 	if pIF, exist := partitionMap["end"]; exist {
 		result.endNum = pIF.(string)
 	} else {
-		err = errors.New("require partition.end")
+		err = errors.New("require partition.end or partition.values")
 		return
 	}
 	if pIF, exist := partitionMap["each"]; exist {
 		result.eachRow = pIF.(string)
+	} else {
+		result.eachRow = "10000"
+	}
+	result.definitions = partitionDefinitions(result)
+
+	return
+}
+
+func parseForeignKey(tableName string, fkMap map[string]interface{}) (result foreignKeyInfo, err error) {
+	result = foreignKeyInfo{tableName: tableName}
+
+	if fkIF, exist := fkMap["columns"]; exist {
+		result.columns = strings.Split(fkIF.(string), ",")
+	} else {
+		err = errors.New(fmt.Sprintf("table: %v require foreign_keys.columns", tableName))
+		return
+	}
+	if fkIF, exist := fkMap["ref_table"]; exist {
+		result.refTable = fkIF.(string)
+	} else {
+		err = errors.New(fmt.Sprintf("table: %v require foreign_keys.ref_table", tableName))
+		return
 	}
-	result.eachRow = "10000" // 2021-06-16 一旦10000固定
+	if fkIF, exist := fkMap["ref_columns"]; exist {
+		result.refColumns = strings.Split(fkIF.(string), ",")
+	} else {
+		err = errors.New(fmt.Sprintf("table: %v require foreign_keys.ref_columns", tableName))
+		return
+	}
+	if len(result.columns) != len(result.refColumns) {
+		err = errors.New(fmt.Sprintf("table: %v foreign_keys.columns and foreign_keys.ref_columns must be the same length", tableName))
+		return
+	}
+	if fkIF, exist := fkMap["name"]; exist {
+		result.name = fkIF.(string)
+	} else {
+		result.name = generatedForeignKeyName(tableName, result.columns)
+	}
+	var action string
+	if fkIF, exist := fkMap["on_delete"]; exist {
+		action = fkIF.(string)
+	}
+	result.onDelete = normalizeReferentialAction(action)
+	action = ""
+	if fkIF, exist := fkMap["on_update"]; exist {
+		action = fkIF.(string)
+	}
+	result.onUpdate = normalizeReferentialAction(action)
 
 	return
 }
+
+// InnoDBではNO ACTIONとRESTRICTは同じ挙動で、未指定時の表記がmysqlとmariadbで異なるのでRESTRICTに寄せる
+func normalizeReferentialAction(action string) string {
+	action = strings.Join(strings.Fields(strings.ToUpper(action)), " ")
+	if action == "" || action == "NO ACTION" {
+		return "RESTRICT"
+	}
+
+	return action
+}
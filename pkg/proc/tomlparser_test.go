@@ -0,0 +1,52 @@
+package proc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		column  map[string]interface{}
+		want    tableColumn
+		wantErr bool
+	}{
+		{
+			name:   "enum values",
+			column: map[string]interface{}{"name": "e", "type": "enum", "values": []interface{}{"a", "b"}},
+			want:   tableColumn{name: "e", columnType: "enum", values: []string{"a", "b"}},
+		},
+		{
+			name:   "enum size",
+			column: map[string]interface{}{"name": "e", "type": "ENUM", "size": "'a','b'"},
+			want:   tableColumn{name: "e", columnType: "enum", values: []string{"a", "b"}},
+		},
+		{
+			name:    "enum size and values",
+			column:  map[string]interface{}{"name": "e", "type": "set", "size": "10", "values": []interface{}{"a", "b"}},
+			wantErr: true,
+		},
+		{
+			name:    "enum without values",
+			column:  map[string]interface{}{"name": "e", "type": "enum"},
+			wantErr: true,
+		},
+		{
+			name:    "values for varchar",
+			column:  map[string]interface{}{"name": "v", "type": "varchar", "size": "10", "values": []interface{}{"a"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseColumns(tt.column)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
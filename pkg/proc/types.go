@@ -4,6 +4,8 @@ import "database/sql"
 
 type schema struct {
 	database        DatabaseInfo
+	server          serverInfo // DBから読み込んだ場合のみ
+	options         schemaOptions
 	tables          []tableInfo
 	tablesMap       map[string]tableInfo             // map[tableName]
 	indexInfosSlice map[string][]string              // map[tableName][]indexName indexの順番保持用
@@ -20,48 +22,102 @@ type DatabaseInfo struct {
 	Collation string
 }
 
+type schemaOptions struct {
+	mergeAlter      bool // テーブルごとの変更を1つのALTER TABLEにまとめる
+	syncColumnOrder bool // カラムの並び順もtomlに合わせる
+	onlineDDL       onlineDDLOption
+}
+
 type tableInfo struct {
-	name       string
-	columns    []tableColumn
-	columnsMap map[string]tableColumn
-	partition  partitionInfo
-	engine     string
+	name         string
+	columns      []tableColumn
+	columnsMap   map[string]tableColumn
+	partition    partitionInfo
+	engine       string
+	engineOption engineOption // Mroongaのみ
+	tableOption  tableOption
+	foreignKeys  []foreignKeyInfo
+	onlineDDL    onlineDDLOption // テーブルごとの指定がなければ[options]の指定
+	// map[新カラム名]旧カラム名 tomlのrenamed_fromのみ
+	columnRenames map[string]string
+	renamedFrom   string // tomlのrenamed_fromのみ
 }
 
 type tableColumn struct {
 	name         string
 	columnType   string
 	size         string
+	precision    string   // decimal, float, doubleの全体の桁数
+	scale        string   // decimal, float, doubleの小数点以下の桁数
+	fsp          string   // datetime, timestamp, timeの小数秒の桁数
+	values       []string // enum, setの値
 	unsigned     bool
 	autoInc      bool
 	null         bool
 	defaultValue defaultDetail
+	onUpdate     string // CURRENT_TIMESTAMP, CURRENT_TIMESTAMP(fsp)
+	charset      string // tomlで指定していない場合はDBのものを引き継ぐ(inheritColumnCharset)
+	collation    string
+	comment      string
 }
 
 // e.g. PARTITION BY partitionType (keyColumn) (PARTITION [[name]][[startNum]]...[[endNum]] VALUES LESS THAN (eachRow))
 // endNumのときeachRowはMAXVALUE
+// valuesが指定されている場合は[[name]][[startNum]]から順にvaluesの値で区切る(listはVALUES IN (value))
+// hash, keyはPARTITION BY partitionType (keyColumn) PARTITIONS partitions
+// range, listはSUBPARTITION BYでhash, keyのサブパーティションにできる
+// intervalが指定されている場合はstartNumからendNumの日付まで月ごと、日ごとに[[name]][[日付]]で区切って最後は[[name]]maxでMAXVALUE
 type partitionInfo struct {
-	partitionType string
-	keyColumn     string
+	partitionType string // range, range columns, list, list columns, [linear] hash, [linear] key
+	keyColumn     string // columnsとkeyはカンマ区切りで複数、rangeはTO_DAYS(created_at)のような式も可
 	baseName      string
-	startNum      string // 2021-06-16 1で一旦固定
-	endNum        string
-	eachRow       string // 2021-06-16 10000区切りで一旦固定
+	startNum      string // intervalの場合は日付
+	endNum        string // intervalの場合は日付
+	eachRow       string
+	values        []string
+	partitions    string
+	interval      string                // month, day
+	future        string                // gomig partitionsで常に作っておく未来のパーティションの数
+	retention     string                // gomig partitionsで残しておく過去のパーティションの数 空の場合は削除しない
+	definitions   []partitionDefinition // 実際に作られるパーティション
+
+	// SUBPARTITION BY subPartitionType (subPartitionKey) SUBPARTITIONS subPartitions
+	subPartitionType string // [linear] hash, [linear] key
+	subPartitionKey  string
+	subPartitions    string
+}
+
+// MroongaのテーブルのCOMMENTで指定するもの
+// e.g. ENGINE=Mroonga COMMENT='engine "InnoDB", default_tokenizer "TokenMecab", normalizer "NormalizerAuto"'
+type engineOption struct {
+	wrappedEngine    string // ラッパーモードの場合のストレージエンジン
+	defaultTokenizer string // fulltext indexでtokenizerを指定しない場合のtokenizer
+	normalizer       string
+	tokenFilters     []string
+}
+
+// CREATE TABLE, ALTER TABLEのテーブルオプション
+// tomlで指定していないものはDBと比較しない
+type tableOption struct {
+	charset         string
+	collation       string
+	comment         string
+	rowFormat       string // DYNAMIC, COMPRESSEDなど
+	keyBlockSize    string // 0は未指定
+	statsPersistent string // 0, 1, DEFAULT
+	autoIncrement   string // DBの値の方が小さい場合のみ変更する
 }
 
 type defaultDetail struct {
-	need  bool
-	value string
+	need      bool
+	kind      defaultKind
+	value     string // 関数の場合はCURRENT_TIMESTAMP
+	precision string // 関数の場合の小数秒の桁数
 }
 
+// Queries 差分のDDL 実行順はplanDDLで決める
 type Queries struct {
-	CreateTables  []string
-	AddColumns    []string
-	ModifyColumns []string
-	DropTables    []string
-	DropColumns   []string
-	AddIndexes    []string
-	DropIndexes   []string
+	changes []*ddlChange
 }
 
 type descColumns struct {
@@ -71,6 +127,9 @@ type descColumns struct {
 	key          string
 	defaultValue sql.NullString
 	extra        string
+	charset      sql.NullString
+	collation    sql.NullString
+	comment      string
 }
 
 type indexInfo struct {
@@ -79,5 +138,25 @@ type indexInfo struct {
 	indexName string
 	indexType string // 2021-06-15 BTREE or FULLTEXT のみ
 	columns   []string
-	comment   string // 'tokenizer "TokenBigramSplitSymbolAlphaDigit"' のみ
+	fulltext  fulltextOption // FULLTEXTのみ
+}
+
+// Mroongaのfulltext indexのCOMMENTで指定するもの
+// e.g. COMMENT 'tokenizer "TokenBigram", normalizer "NormalizerAuto", token_filters "TokenFilterStopWord"'
+// InnoDBなどMroonga以外はWITH PARSER parserのみ
+type fulltextOption struct {
+	tokenizer    string
+	normalizer   string
+	tokenFilters []string
+	parser       string // ngram, mecab 空の場合は組み込みのparser
+}
+
+type foreignKeyInfo struct {
+	tableName  string
+	name       string
+	columns    []string
+	refTable   string
+	refColumns []string
+	onDelete   string // RESTRICT(NO ACTION含む) CASCADE SET NULL SET DEFAULT
+	onUpdate   string
 }